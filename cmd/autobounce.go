@@ -32,6 +32,7 @@ package cmd
 
 import (
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 )
 
 var autoBounceCmd = &cobra.Command{
@@ -40,13 +41,32 @@ var autoBounceCmd = &cobra.Command{
 	Long: `
 Scan all event files in the mailgun.events store.  For each 'failure' event
 that is not present in the mailgun.bounces store, generate and send a bounce
-message.  After sending the bounce, write the key into the mailgun.bounced
-store.
+message.  After sending the bounce, write an audit record for the event into
+the mailgun.bounced store; see 'mailgun bounced'.
+
+Failures of the same message and sender are reported in a single bounce
+with a block for each recipient.  Failures are collected for
+bounce_collect_window after the first one before the bounce is sent.
+
+Temporary failures produce a single 'delayed' warning per message recipient,
+recorded in the mailgun.delayed store.  A failure bounce follows when mailgun
+reports a permanent failure or when the delay exceeds delay_bounce_after.
+
+Bounces the transport fails to send are kept in the mailgun.queue store and
+retried on later runs; see 'mailgun bounce queue'.
+
+With complaint_reports set, each 'complained' event is also reported as an
+RFC 5965 abuse feedback report to complaint_report_to, or to the original
+sender when that is unset, and recorded in the mailgun.complaints store.
 `,
 	Run: func(cmd *cobra.Command, args []string) {
 		api := NewClient()
 		err := api.SendBounces()
 		cobra.CheckErr(err)
+		if viper.GetBool("complaint_reports") {
+			err := api.SendComplaintReports()
+			cobra.CheckErr(err)
+		}
 	},
 }
 
@@ -0,0 +1,345 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-message"
+	"github.com/emersion/go-message/mail"
+	"github.com/emersion/go-message/textproto"
+	"github.com/mailgun/mailgun-go/v5/events"
+	"github.com/spf13/viper"
+)
+
+// originalMessage returns the stored original message for an event, or nil
+// if it is not available
+func (c *Client) originalMessage(event *events.Failed) []byte {
+	original, err := c.FetchStoredMessage(&event.Storage)
+	if err != nil {
+		if !viper.GetBool("quiet") {
+			log.Printf("stored_message_unavailable: %s %v\n", event.GetID(), err)
+		}
+		return nil
+	}
+	return original
+}
+
+// arrivalDate returns the time mailgun accepted a message from the first
+// accepted event for the Message-ID stored before a later event, or the zero
+// time when none is stored; it scans the events store, so SendBounces
+// collects the accepted times in its own pass instead
+func (c *Client) arrivalDate(messageID string, before time.Time) time.Time {
+	if messageID == "" {
+		return time.Time{}
+	}
+	accepted, err := c.LocalEvents(&EventFilter{
+		End:       before,
+		Event:     events.EventAccepted,
+		MessageID: messageID,
+		Ascending: true,
+		Limit:     1,
+	})
+	if err != nil || len(*accepted) == 0 {
+		return time.Time{}
+	}
+	return (*accepted)[0].GetTimestamp()
+}
+
+// PreviewBounce renders the bounce for a failed event without applying the
+// suppression rules, sending it or updating any store
+func (c *Client) PreviewBounce(event *events.Failed, action string, fetchOriginal bool) ([]byte, error) {
+	if action == "" {
+		action = "failed"
+		if event.Severity == "temporary" {
+			action = "delayed"
+		}
+	}
+	if action != "failed" && action != "delayed" {
+		return nil, fmt.Errorf("unsupported action: %s", action)
+	}
+	var original []byte
+	if fetchOriginal {
+		original = c.originalMessage(event)
+	}
+	var buf bytes.Buffer
+	err := c.formatBounce(event, action, original, &buf)
+	if err != nil {
+		return nil, err
+	}
+	return c.signBounce(buf.Bytes())
+}
+
+// RecipientStatus holds the per-recipient fields of a delivery status
+// notification
+type RecipientStatus struct {
+	EventKey   string    `json:"event_key"`
+	MessageID  string    `json:"message_id"`
+	Subject    string    `json:"subject"`
+	Recipient  string    `json:"recipient"`
+	Action     string    `json:"action"`
+	Status     string    `json:"status"`
+	Code       int       `json:"code"`
+	Message    string    `json:"message"`
+	RemoteMTA  string    `json:"remote_mta,omitempty"`
+	Diagnostic string    `json:"diagnostic"`
+	Category   string    `json:"category"`
+	Timestamp  time.Time `json:"timestamp"`
+}
+
+func (c *Client) newRecipientStatus(key string, event *events.Failed, action string) RecipientStatus {
+	return RecipientStatus{
+		EventKey:   key,
+		MessageID:  event.Message.Headers.MessageID,
+		Subject:    event.Message.Headers.Subject,
+		Recipient:  event.Recipient,
+		Action:     action,
+		Status:     dsnStatus(event),
+		Code:       event.DeliveryStatus.Code,
+		Message:    event.DeliveryStatus.Message,
+		RemoteMTA:  event.DeliveryStatus.MxHost,
+		Diagnostic: dsnDiagnostic(&event.DeliveryStatus),
+		Category:   c.classifier.Classify(event),
+		Timestamp:  event.GetTimestamp(),
+	}
+}
+
+// formatBounce writes an RFC 3464 delivery status notification with the
+// given action, failed or delayed, for a failed event as a multipart/report
+// message with a human-readable part, a message/delivery-status part and the
+// original message, or only its headers when the stored message is nil or
+// exceeds bounce_attach_max_size
+func (c *Client) formatBounce(event *events.Failed, action string, original []byte, buf *bytes.Buffer) error {
+	recipients := []RecipientStatus{c.newRecipientStatus(event.GetID(), event, action)}
+	return c.formatGroupBounce(event, action, recipients, original, c.arrivalDate(event.Message.Headers.MessageID, event.GetTimestamp()), buf)
+}
+
+// formatGroupBounce writes a delivery status notification for the failed
+// recipients of one message, where event is the first failure and arrival,
+// when set, is the time mailgun accepted the message
+func (c *Client) formatGroupBounce(event *events.Failed, action string, recipients []RecipientStatus, original []byte, arrival time.Time, buf *bytes.Buffer) error {
+
+	identity, err := LoadBounceIdentity(c.domain)
+	if err != nil {
+		return err
+	}
+
+	attachOriginal := original != nil && len(original) <= viper.GetInt("bounce_attach_max_size")
+
+	bounceTemplate, err := LoadBounceTemplate(c.domain, "bounce")
+	if err != nil {
+		return err
+	}
+	subject, text, html, err := bounceTemplate.Render(&BounceData{
+		Failed:           event,
+		Action:           action,
+		Status:           dsnStatus(event),
+		Recipients:       recipients,
+		Domain:           c.domain,
+		Hostname:         identity.ReportingMTA,
+		OriginalAttached: attachOriginal,
+	})
+	if err != nil {
+		return err
+	}
+
+	writer, err := c.createReport(buf, identity, event.Envelope.Sender, subject, "delivery-status")
+	if err != nil {
+		return err
+	}
+
+	err = c.addHumanPart(writer, text, html)
+	if err != nil {
+		return err
+	}
+
+	err = c.addDeliveryStatusPart(writer, identity.ReportingMTA, arrival, recipients)
+	if err != nil {
+		return err
+	}
+
+	err = c.addOriginalPart(writer, event, original, attachOriginal)
+	if err != nil {
+		return err
+	}
+
+	return writer.Close()
+}
+
+// createReport writes the message header of a report of the given type,
+// delivery-status or feedback-report, and returns the multipart/report
+// writer for its parts
+func (c *Client) createReport(buf *bytes.Buffer, identity *BounceIdentity, sender, subject, reportType string) (*message.Writer, error) {
+	from := []*mail.Address{{Name: identity.FromName, Address: identity.FromAddress}}
+	to := []*mail.Address{{Address: normalizeAddress(sender)}}
+
+	var mailHeader mail.Header
+	mailHeader.SetDate(time.Now())
+	mailHeader.SetAddressList("From", from)
+	mailHeader.SetAddressList("To", to)
+	mailHeader.SetSubject(subject)
+	err := mailHeader.GenerateMessageIDWithHostname(identity.ReportingMTA)
+	if err != nil {
+		return nil, err
+	}
+	if reportType == "delivery-status" {
+		mailHeader.Set("Auto-Submitted", "auto-replied")
+	} else {
+		mailHeader.Set("Auto-Submitted", "auto-generated")
+	}
+	mailHeader.SetContentType("multipart/report", map[string]string{"report-type": reportType})
+
+	return message.CreateWriter(buf, mailHeader.Header)
+}
+
+// addDeliveryStatusPart writes the message/delivery-status part with the
+// per-message fields followed by a field group for each recipient
+func (c *Client) addDeliveryStatusPart(writer *message.Writer, reportingMTA string, arrival time.Time, recipients []RecipientStatus) error {
+	var buf bytes.Buffer
+	writeDSNField(&buf, "Reporting-MTA", "dns; "+reportingMTA)
+	if !arrival.IsZero() {
+		writeDSNField(&buf, "Arrival-Date", arrival.Format(time.RFC1123Z))
+	}
+	for _, recipient := range recipients {
+		buf.WriteString("\r\n")
+		writeDSNField(&buf, "Final-Recipient", dsnAddress(recipient.Recipient))
+		writeDSNField(&buf, "Action", recipient.Action)
+		writeDSNField(&buf, "Status", recipient.Status)
+		if recipient.RemoteMTA != "" {
+			writeDSNField(&buf, "Remote-MTA", "dns; "+asciiHostname(recipient.RemoteMTA))
+		}
+		writeDSNField(&buf, "Diagnostic-Code", recipient.Diagnostic)
+		writeDSNField(&buf, "Last-Attempt-Date", recipient.Timestamp.Format(time.RFC1123Z))
+	}
+	return c.addPart(writer, "message/delivery-status", nil, &buf)
+}
+
+// addOriginalPart writes the returned content part of the report: the stored
+// message itself, the stored message header, or failing both the header
+// recorded in the event
+func (c *Client) addOriginalPart(writer *message.Writer, event *events.Failed, original []byte, attach bool) error {
+	if attach {
+		return c.addPart(writer, "message/rfc822", nil, bytes.NewBuffer(original))
+	}
+	header := originalHeaders(&event.Message.Headers).Header.Header
+	if original != nil {
+		var err error
+		header, err = textproto.ReadHeader(bufio.NewReader(bytes.NewReader(original)))
+		if err != nil {
+			return err
+		}
+	}
+	var buf bytes.Buffer
+	err := textproto.WriteHeader(&buf, header)
+	if err != nil {
+		return err
+	}
+	return c.addPart(writer, "text/rfc822-headers", nil, &buf)
+}
+
+func (c *Client) addPart(writer *message.Writer, contentType string, params map[string]string, buf *bytes.Buffer) error {
+	var header message.Header
+	header.SetContentType(contentType, params)
+	if contentType == "text/plain" || contentType == "text/html" {
+		header.Set("Content-Transfer-Encoding", "quoted-printable")
+	}
+	part, err := writer.CreatePart(header)
+	if err != nil {
+		return err
+	}
+	_, err = part.Write(buf.Bytes())
+	if err != nil {
+		part.Close()
+		return err
+	}
+	return part.Close()
+}
+
+// addHumanPart writes the human-readable part of the report, as
+// multipart/alternative when an HTML body is present
+func (c *Client) addHumanPart(writer *message.Writer, text, html []byte) error {
+	if html == nil {
+		return c.addPart(writer, "text/plain", map[string]string{"charset": "utf-8"}, bytes.NewBuffer(text))
+	}
+	var header message.Header
+	header.SetContentType("multipart/alternative", nil)
+	alternative, err := writer.CreatePart(header)
+	if err != nil {
+		return err
+	}
+	err = c.addPart(alternative, "text/plain", map[string]string{"charset": "utf-8"}, bytes.NewBuffer(text))
+	if err != nil {
+		return err
+	}
+	err = c.addPart(alternative, "text/html", map[string]string{"charset": "utf-8"}, bytes.NewBuffer(html))
+	if err != nil {
+		return err
+	}
+	return alternative.Close()
+}
+
+func writeDSNField(buf *bytes.Buffer, name, value string) {
+	buf.WriteString(fmt.Sprintf("%s: %s\r\n", name, value))
+}
+
+// dsnStatus returns the RFC 3463 enhanced status code for a failed event,
+// deriving the class from the SMTP reply code when mailgun supplies none
+func dsnStatus(event *events.Failed) string {
+	if event.DeliveryStatus.EnhancedCode != "" {
+		return event.DeliveryStatus.EnhancedCode
+	}
+	code := event.DeliveryStatus.Code
+	switch {
+	case code >= 400 && code < 500:
+		return "4.0.0"
+	case code >= 500 && code < 600:
+		return "5.0.0"
+	case event.Severity == "temporary":
+		return "4.0.0"
+	}
+	return "5.0.0"
+}
+
+// dsnDiagnostic formats the Diagnostic-Code field; reply codes outside the
+// SMTP range are mailgun internal codes and are typed accordingly
+func dsnDiagnostic(status *events.DeliveryStatus) string {
+	text := status.Message
+	if text == "" {
+		text = status.Description
+	}
+	text = strings.Join(strings.Fields(text), " ")
+	diagType := "smtp"
+	if status.Code < 200 || status.Code >= 600 {
+		diagType = "X-Mailgun"
+	}
+	return strings.TrimSpace(fmt.Sprintf("%s; %d %s", diagType, status.Code, text))
+}
+
+// originalHeaders rebuilds the original message header from the headers
+// recorded in the event
+func originalHeaders(headers *events.MessageHeaders) *mail.Header {
+	var header mail.Header
+	// textproto.WriteHeader emits fields in reverse order of insertion
+	header.SetMessageID(strings.Trim(headers.MessageID, "<>"))
+	if headers.Subject != "" {
+		header.SetSubject(headers.Subject)
+	}
+	setAddressHeader(&header, "To", headers.To)
+	setAddressHeader(&header, "From", headers.From)
+	return &header
+}
+
+func setAddressHeader(header *mail.Header, key, value string) {
+	if value == "" {
+		return
+	}
+	addrs, err := mail.ParseAddressList(value)
+	if err != nil {
+		header.Set(key, value)
+		return
+	}
+	header.SetAddressList(key, addrs)
+}
@@ -0,0 +1,560 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-message"
+	"github.com/emersion/go-message/mail"
+	"github.com/mailgun/mailgun-go/v5/events"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite golden files")
+
+func loadTestEvent(t *testing.T, name string) events.Event {
+	data, err := os.ReadFile(filepath.Join("testdata", "events", name))
+	require.Nil(t, err)
+	event, err := events.ParseEvent(data)
+	require.Nil(t, err)
+	return event
+}
+
+// dumpEntity renders the leaf parts of a parsed message as content type and
+// body, normalizing the values that vary from host to host
+func dumpEntity(t *testing.T, entity *message.Entity) string {
+	hostname, err := os.Hostname()
+	require.Nil(t, err)
+	var dump strings.Builder
+	err = entity.Walk(func(path []int, part *message.Entity, err error) error {
+		if err != nil {
+			return err
+		}
+		if part.MultipartReader() != nil {
+			return nil
+		}
+		contentType, _, err := part.Header.ContentType()
+		if err != nil {
+			return err
+		}
+		body, err := io.ReadAll(part.Body)
+		if err != nil {
+			return err
+		}
+		text := strings.ReplaceAll(string(body), "\r\n", "\n")
+		text = strings.ReplaceAll(text, "Reporting-MTA: dns; "+hostname+"\n", "Reporting-MTA: dns; HOSTNAME\n")
+		dump.WriteString("--- " + contentType + "\n")
+		dump.WriteString(text)
+		if !strings.HasSuffix(text, "\n") {
+			dump.WriteString("\n")
+		}
+		return nil
+	})
+	require.Nil(t, err)
+	return dump.String()
+}
+
+func checkGolden(t *testing.T, name, actual string) {
+	pathname := filepath.Join("testdata", "golden", name)
+	if *updateGolden {
+		err := os.WriteFile(pathname, []byte(actual), 0600)
+		require.Nil(t, err)
+	}
+	expected, err := os.ReadFile(pathname)
+	require.Nil(t, err)
+	require.Equal(t, string(expected), actual)
+}
+
+func TestFormatBounce(t *testing.T) {
+	api, _ := newTestClient(t)
+	failed := loadTestEvent(t, "failed.json").(*events.Failed)
+	var buf bytes.Buffer
+	err := api.formatBounce(failed, "failed", nil, &buf)
+	require.Nil(t, err)
+	require.NotContains(t, buf.String(), "Arrival-Date")
+
+	// the Arrival-Date is when mailgun accepted the message
+	require.Nil(t, api.storeEvent(&events.Accepted{
+		Generic: events.Generic{EventName: events.EventName{Name: events.EventAccepted}, ID: "accepted-1", Timestamp: failed.Timestamp - 60},
+		Message: events.Message{Headers: events.MessageHeaders{MessageID: failed.Message.Headers.MessageID}},
+	}))
+	buf.Reset()
+	err = api.formatBounce(failed, "failed", nil, &buf)
+	require.Nil(t, err)
+
+	entity, err := message.Read(&buf)
+	require.Nil(t, err)
+	mediaType, params, err := entity.Header.ContentType()
+	require.Nil(t, err)
+	require.Equal(t, "multipart/report", mediaType)
+	require.Equal(t, "delivery-status", params["report-type"])
+	require.Equal(t, "<alice@example.com>", entity.Header.Get("To"))
+	require.Contains(t, entity.Header.Get("From"), "MAILER-DAEMON@")
+	require.Equal(t, "auto-replied", entity.Header.Get("Auto-Submitted"))
+	require.NotEmpty(t, entity.Header.Get("Message-Id"))
+
+	checkGolden(t, "bounce_failed.txt", dumpEntity(t, entity))
+}
+
+// startStorageServer serves the stored message endpoint for an event
+func startStorageServer(t *testing.T, key string) *httptest.Server {
+	original, err := os.ReadFile(filepath.Join("testdata", "messages", "original.eml"))
+	require.Nil(t, err)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v3/domains/example.com/messages/"+key {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"recipients": "nobody@example.org",
+			"sender":     "alice@example.com",
+			"body-mime":  string(original),
+		})
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func readBounceParts(t *testing.T, buf *bytes.Buffer) map[string]string {
+	entity, err := message.Read(buf)
+	require.Nil(t, err)
+	parts := map[string]string{}
+	reader := entity.MultipartReader()
+	require.NotNil(t, reader)
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		require.Nil(t, err)
+		contentType, _, err := part.Header.ContentType()
+		require.Nil(t, err)
+		body, err := io.ReadAll(part.Body)
+		require.Nil(t, err)
+		parts[contentType] = string(body)
+	}
+	return parts
+}
+
+func TestFormatBounceStoredMessage(t *testing.T) {
+	initTestConfig()
+	api := NewClient()
+	failed := loadTestEvent(t, "failed.json").(*events.Failed)
+	server := startStorageServer(t, failed.Storage.Key)
+	failed.Storage.URL = server.URL + "/v3/domains/example.com/messages/" + failed.Storage.Key
+
+	original := api.originalMessage(failed)
+	require.NotNil(t, original)
+	var buf bytes.Buffer
+	err := api.formatBounce(failed, "failed", original, &buf)
+	require.Nil(t, err)
+	parts := readBounceParts(t, &buf)
+	require.Contains(t, parts["text/plain"], "A copy of the original message is attached.")
+	require.Contains(t, parts["message/rfc822"], "The quarterly numbers are attached.")
+	require.NotContains(t, parts, "text/rfc822-headers")
+
+	viper.Set("bounce_attach_max_size", 64)
+	defer viper.Set("bounce_attach_max_size", 1048576)
+	buf.Reset()
+	err = api.formatBounce(failed, "failed", original, &buf)
+	require.Nil(t, err)
+	parts = readBounceParts(t, &buf)
+	require.Contains(t, parts["text/plain"], "The headers of the original message are attached.")
+	require.NotContains(t, parts, "message/rfc822")
+	require.Contains(t, parts["text/rfc822-headers"], "X-Campaign: q3")
+	require.NotContains(t, parts["text/rfc822-headers"], "The quarterly numbers")
+
+	failed.Storage.URL = server.URL + "/v3/domains/example.com/messages/expired"
+	original = api.originalMessage(failed)
+	require.Nil(t, original)
+	buf.Reset()
+	err = api.formatBounce(failed, "failed", original, &buf)
+	require.Nil(t, err)
+	parts = readBounceParts(t, &buf)
+	require.Contains(t, parts["text/rfc822-headers"], "Subject: Quarterly report")
+	require.NotContains(t, parts["text/rfc822-headers"], "X-Campaign")
+}
+
+func writeTemplate(t *testing.T, pathname, text string) {
+	err := os.MkdirAll(filepath.Dir(pathname), 0700)
+	require.Nil(t, err)
+	err = os.WriteFile(pathname, []byte(text), 0600)
+	require.Nil(t, err)
+}
+
+func TestBounceTemplate(t *testing.T) {
+	api, _ := newTestClient(t)
+	failed := loadTestEvent(t, "failed.json").(*events.Failed)
+	data := BounceData{
+		Failed:     failed,
+		Action:     "failed",
+		Status:     dsnStatus(failed),
+		Recipients: []RecipientStatus{api.newRecipientStatus(failed.ID, failed, "failed")},
+		Domain:     "example.com",
+	}
+
+	dir := t.TempDir()
+	viper.Set("template_dir", dir)
+	defer viper.Set("template_dir", "")
+
+	bt, err := LoadBounceTemplate("example.com", "bounce")
+	require.Nil(t, err)
+	subject, text, html, err := bt.Render(&data)
+	require.Nil(t, err)
+	require.Equal(t, "Delivery status notification: failed", subject)
+	require.Contains(t, string(text), "nobody@example.org: 550")
+	require.Nil(t, html)
+
+	writeTemplate(t, filepath.Join(dir, "bounce.txt"), "global {{.Recipient}} {{.Status}} {{join .Tags \",\"}}\n")
+	writeTemplate(t, filepath.Join(dir, "example.com", "bounce.de.txt"),
+		"{{define \"subject\"}}Unzustellbar: {{.Message.Headers.Subject}}{{end}}{{.Severity}} {{.Reason}}\n")
+	writeTemplate(t, filepath.Join(dir, "example.com", "bounce.html"), "<p>{{.Recipient}}</p>\n")
+
+	bt, err = LoadBounceTemplate("other.example", "bounce")
+	require.Nil(t, err)
+	subject, text, html, err = bt.Render(&data)
+	require.Nil(t, err)
+	require.Equal(t, "Delivery status notification: failed", subject)
+	require.Equal(t, "global nobody@example.org 5.1.1 newsletter\n", string(text))
+	require.Nil(t, html)
+
+	viper.Set("domains", map[string]any{"example.com": map[string]any{"bounce_language": "de"}})
+	defer viper.Set("domains", nil)
+	bt, err = LoadBounceTemplate("example.com", "bounce")
+	require.Nil(t, err)
+	subject, text, html, err = bt.Render(&data)
+	require.Nil(t, err)
+	require.Equal(t, "Unzustellbar: Quarterly report", subject)
+	require.Equal(t, "permanent bounce\n", string(text))
+	require.Equal(t, "<p>nobody@example.org</p>\n", string(html))
+}
+
+// recordingTransport captures bounces instead of sending them
+type recordingTransport struct {
+	messages []testMessage
+}
+
+func (t *recordingTransport) Name() string {
+	return "recording"
+}
+
+func (t *recordingTransport) Send(sender string, recipients []string, message []byte) error {
+	t.messages = append(t.messages, testMessage{Sender: sender, Recipients: recipients, Data: message})
+	return nil
+}
+
+// newTestClient returns a client with empty stores and a recording transport
+func newTestClient(t *testing.T) (*Client, *recordingTransport) {
+	initTestConfig()
+	viper.Set("data_root", t.TempDir())
+	t.Cleanup(func() { viper.Set("data_root", "testdata/db") })
+	api := NewClient()
+	transport := recordingTransport{}
+	api.transport = &transport
+	return api, &transport
+}
+
+// failedVariant returns a copy of the failed.json event with a new ID
+func failedVariant(t *testing.T, id, severity string) *events.Failed {
+	failed := loadTestEvent(t, "failed.json").(*events.Failed)
+	failed.Storage = events.Storage{}
+	failed.ID = id
+	failed.Severity = severity
+	if severity == "temporary" {
+		failed.DeliveryStatus.Code = 452
+		failed.DeliveryStatus.EnhancedCode = "4.2.2"
+		failed.DeliveryStatus.Message = "mailbox full"
+	}
+	return failed
+}
+
+func bounceAction(t *testing.T, data []byte) string {
+	parts := readBounceParts(t, bytes.NewBuffer(data))
+	for _, line := range strings.Split(parts["message/delivery-status"], "\r\n") {
+		if strings.HasPrefix(line, "Action: ") {
+			return strings.TrimPrefix(line, "Action: ")
+		}
+	}
+	return ""
+}
+
+func TestDelayedWarning(t *testing.T) {
+	api, transport := newTestClient(t)
+	viper.Set("delay_bounce_after", "87600h")
+	defer viper.Set("delay_bounce_after", "24h")
+
+	require.Nil(t, api.storeEvent(failedVariant(t, "temp1", "temporary")))
+	require.Nil(t, api.SendBounces())
+	require.Len(t, transport.messages, 1)
+	require.Equal(t, "delayed", bounceAction(t, transport.messages[0].Data))
+
+	require.Nil(t, api.storeEvent(failedVariant(t, "temp2", "temporary")))
+	require.Nil(t, api.SendBounces())
+	require.Len(t, transport.messages, 1)
+
+	viper.Set("delay_bounce_after", "1h")
+	require.Nil(t, api.SendBounces())
+	require.Len(t, transport.messages, 2)
+	require.Equal(t, "failed", bounceAction(t, transport.messages[1].Data))
+
+	require.Nil(t, api.storeEvent(failedVariant(t, "perm1", "permanent")))
+	require.Nil(t, api.SendBounces())
+	require.Len(t, transport.messages, 2)
+}
+
+func TestPermanentFailure(t *testing.T) {
+	api, transport := newTestClient(t)
+	failed := failedVariant(t, "perm1", "permanent")
+	require.Nil(t, api.storeEvent(failed))
+	require.Nil(t, api.storeEvent(&events.Accepted{
+		Generic: events.Generic{EventName: events.EventName{Name: events.EventAccepted}, ID: "accepted-1", Timestamp: failed.Timestamp - 90},
+		Message: events.Message{Headers: events.MessageHeaders{MessageID: failed.Message.Headers.MessageID}},
+	}))
+	require.Nil(t, api.SendBounces())
+	require.Nil(t, api.SendBounces())
+	require.Len(t, transport.messages, 1)
+	require.Equal(t, "failed", bounceAction(t, transport.messages[0].Data))
+	require.Equal(t, []string{"alice@example.com"}, transport.messages[0].Recipients)
+	parts := readBounceParts(t, bytes.NewBuffer(transport.messages[0].Data))
+	require.Contains(t, parts["message/delivery-status"], "Arrival-Date: Thu, 16 Oct 2025 11:58:30 +0000\r\n")
+}
+
+func TestSuppressBounce(t *testing.T) {
+	api, transport := newTestClient(t)
+	cases := []struct {
+		sender   string
+		header   string
+		expected string
+	}{
+		{"alice@example.com", "", ""},
+		{"", "", "null sender"},
+		{"<>", "", "null sender"},
+		{"MAILER-DAEMON@example.com", "", "sender local part mailer-daemon"},
+		{"noreply@example.com", "", "sender local part noreply"},
+		{"alice@example.com", "Auto-Submitted: auto-replied\r\n", "auto-submitted auto-replied"},
+		{"alice@example.com", "Auto-Submitted: no\r\n", ""},
+		{"alice@example.com", "Precedence: bulk\r\n", "precedence bulk"},
+		{"alice@example.com", "Content-Type: multipart/report; report-type=delivery-status; boundary=x\r\n", "message is a delivery status notification"},
+	}
+	for _, tc := range cases {
+		failed := failedVariant(t, "perm", "permanent")
+		failed.Envelope.Sender = tc.sender
+		original := []byte("From: <" + tc.sender + ">\r\n" + tc.header + "Subject: test\r\n\r\nbody\r\n")
+		require.Equal(t, tc.expected, api.suppressReason(failed, original), tc.sender+" "+tc.header)
+	}
+
+	failed := failedVariant(t, "perm1", "permanent")
+	failed.Envelope.Sender = ""
+	require.Nil(t, api.storeEvent(failed))
+	require.Nil(t, api.SendBounces())
+	require.Empty(t, transport.messages)
+	var record BounceRecord
+	_, err := api.bdb.GetObject("perm1", &record)
+	require.Nil(t, err)
+	require.Equal(t, "null sender", record.Suppressed)
+}
+
+func TestBounceRateLimit(t *testing.T) {
+	api, transport := newTestClient(t)
+	viper.Set("bounce_rate_limit", 2)
+	viper.Set("bounce_digest_interval", "1h")
+	defer viper.Set("bounce_rate_limit", 0)
+
+	for _, id := range []string{"a", "b", "c", "d", "e"} {
+		failed := failedVariant(t, id, "permanent")
+		failed.Recipient = id + "@example.org"
+		failed.Message.Headers.MessageID = id + "@example.com"
+		require.Nil(t, api.storeEvent(failed))
+	}
+	require.Nil(t, api.SendBounces())
+	require.Len(t, transport.messages, 2)
+
+	var state SenderLimit
+	_, err := api.ldb.GetObject("alice@example.com", &state)
+	require.Nil(t, err)
+	require.Len(t, state.Pending, 3)
+
+	// the limiter state survives a new client on the same data_root
+	api = NewClient()
+	api.transport = transport
+	viper.Set("bounce_digest_interval", "0s")
+	defer viper.Set("bounce_digest_interval", "1h")
+	require.Nil(t, api.SendBounces())
+	require.Len(t, transport.messages, 3)
+	parts := readBounceParts(t, bytes.NewBuffer(transport.messages[2].Data))
+	status := parts["message/delivery-status"]
+	require.Equal(t, 3, strings.Count(status, "Final-Recipient: "))
+	require.NotContains(t, status, "Arrival-Date")
+	require.Contains(t, parts["text/plain"], "c@example.org: failed 5.1.1 550")
+}
+
+func TestBounceIdentity(t *testing.T) {
+	api, transport := newTestClient(t)
+	viper.Set("bounce_from_name", "Example Postmaster")
+	defer viper.Set("bounce_from_name", "")
+	viper.Set("domains", map[string]any{api.domain: map[string]any{
+		"reporting_mta":          "mx1.example.net",
+		"bounce_envelope_sender": "bounces@example.net",
+	}})
+	defer viper.Set("domains", nil)
+
+	require.Nil(t, api.storeEvent(failedVariant(t, "identity", "permanent")))
+	require.Nil(t, api.SendBounces())
+	require.Len(t, transport.messages, 1)
+	sent := transport.messages[0]
+	require.Equal(t, "bounces@example.net", sent.Sender)
+
+	entity, err := message.Read(bytes.NewReader(sent.Data))
+	require.Nil(t, err)
+	header := mail.Header{Header: entity.Header}
+	from, err := header.AddressList("From")
+	require.Nil(t, err)
+	require.Equal(t, "Example Postmaster", from[0].Name)
+	require.Equal(t, "MAILER-DAEMON@mx1.example.net", from[0].Address)
+	messageID, err := header.MessageID()
+	require.Nil(t, err)
+	require.True(t, strings.HasSuffix(messageID, "@mx1.example.net"), messageID)
+	parts := readBounceParts(t, bytes.NewBuffer(sent.Data))
+	require.Contains(t, parts["message/delivery-status"], "Reporting-MTA: dns; mx1.example.net\r\n")
+
+	identity, err := LoadBounceIdentity("other.example.org")
+	require.Nil(t, err)
+	hostname, err := os.Hostname()
+	require.Nil(t, err)
+	require.Equal(t, hostname, identity.ReportingMTA)
+	require.Equal(t, "MAILER-DAEMON@"+hostname, identity.FromAddress)
+	require.Equal(t, "", identity.EnvelopeSender)
+
+	for key, value := range map[string]string{
+		"reporting_mta":          "relay_01.internal",
+		"bounce_from_address":    "Postmaster <postmaster@example.net>",
+		"bounce_envelope_sender": "bounces",
+	} {
+		viper.Set("domains", map[string]any{"bad.example.org": map[string]any{key: value}})
+		require.ErrorContains(t, ValidateBounceIdentities(), key)
+	}
+	viper.Set("domains", map[string]any{"null.example.org": map[string]any{"bounce_envelope_sender": "<>"}})
+	require.Nil(t, ValidateBounceIdentities())
+	identity, err = LoadBounceIdentity("null.example.org")
+	require.Nil(t, err)
+	require.Equal(t, "<>", identity.EnvelopeSender)
+}
+
+func TestAggregateBounces(t *testing.T) {
+	api, transport := newTestClient(t)
+	recipients := []string{"one@example.org", "two@example.org", "three@example.org"}
+	for i, recipient := range recipients {
+		failed := failedVariant(t, "multi"+recipient, "permanent")
+		failed.Recipient = recipient
+		failed.Timestamp += float64(i)
+		require.Nil(t, api.storeEvent(failed))
+	}
+	delayed := failedVariant(t, "multidelayed", "temporary")
+	delayed.Recipient = "four@example.org"
+	require.Nil(t, api.storeEvent(delayed))
+	other := failedVariant(t, "other", "permanent")
+	other.Message.Headers.MessageID = "other@example.com"
+	require.Nil(t, api.storeEvent(other))
+
+	viper.Set("delay_bounce_after", "87600h")
+	defer viper.Set("delay_bounce_after", "24h")
+	require.Nil(t, api.SendBounces())
+	require.Equal(t, 2, len(transport.messages))
+	counts := []int{bounceCount(t, transport.messages[0].Data), bounceCount(t, transport.messages[1].Data)}
+	require.ElementsMatch(t, []int{1, 4}, counts)
+	data := transport.messages[0].Data
+	if counts[1] == 4 {
+		data = transport.messages[1].Data
+	}
+
+	parts := readBounceParts(t, bytes.NewBuffer(data))
+	status := parts["message/delivery-status"]
+	require.Equal(t, 1, strings.Count(status, "Reporting-MTA: "))
+	require.Equal(t, 3, strings.Count(status, "Action: failed\r\n"))
+	require.Equal(t, 1, strings.Count(status, "Action: delayed\r\n"))
+	for _, recipient := range append(recipients, "four@example.org") {
+		require.Contains(t, status, "Final-Recipient: rfc822; "+recipient+"\r\n")
+		require.Contains(t, parts["text/plain"], recipient+": ")
+	}
+
+	for _, key := range []string{"multione@example.org", "multitwo@example.org", "multithree@example.org", "multidelayed"} {
+		var record BounceRecord
+		_, err := api.bdb.GetObject(key, &record)
+		require.Nil(t, err)
+		require.Len(t, record.Group, 4, key)
+	}
+	var record BounceRecord
+	_, err := api.bdb.GetObject("multidelayed", &record)
+	require.Nil(t, err)
+	require.Equal(t, "delayed", record.Action)
+	require.True(t, api.ddb.Has(deliveryKey(delayed.Message.Headers.MessageID, "four@example.org")))
+
+	// failures still inside the collection window are held for the next run
+	recent := failedVariant(t, "recent", "permanent")
+	recent.Message.Headers.MessageID = "recent@example.com"
+	recent.Timestamp = float64(time.Now().Unix())
+	require.Nil(t, api.storeEvent(recent))
+	require.Nil(t, api.SendBounces())
+	require.Equal(t, 2, len(transport.messages))
+	require.False(t, api.bdb.Has("recent"))
+	viper.Set("bounce_collect_window", "0s")
+	defer viper.Set("bounce_collect_window", "1m")
+	require.Nil(t, api.SendBounces())
+	require.Equal(t, 3, len(transport.messages))
+	require.True(t, api.bdb.Has("recent"))
+}
+
+func bounceCount(t *testing.T, data []byte) int {
+	parts := readBounceParts(t, bytes.NewBuffer(data))
+	return strings.Count(parts["message/delivery-status"], "Final-Recipient: ")
+}
+
+func TestBouncedRecords(t *testing.T) {
+	api, transport := newTestClient(t)
+	viper.Set("bounce_audit_message", true)
+	defer viper.Set("bounce_audit_message", false)
+
+	start := time.Now()
+	require.Nil(t, api.storeEvent(failedVariant(t, "audited", "permanent")))
+	require.Nil(t, api.SendBounces())
+	require.Len(t, transport.messages, 1)
+
+	record, err := api.BouncedRecord("audited")
+	require.Nil(t, err)
+	require.False(t, record.Timestamp.Before(start))
+	require.Equal(t, "alice@example.com", record.Sender)
+	require.Equal(t, "nobody@example.org", record.Recipient)
+	require.Equal(t, "failed", record.Action)
+	require.Equal(t, "5.1.1", record.Status)
+	require.Equal(t, "recording", record.Transport)
+	require.Equal(t, string(transport.messages[0].Data), record.Message)
+	entity, err := message.Read(bytes.NewReader(transport.messages[0].Data))
+	require.Nil(t, err)
+	header := mail.Header{Header: entity.Header}
+	messageID, err := header.MessageID()
+	require.Nil(t, err)
+	require.Equal(t, messageID, record.MessageID)
+
+	legacy := []byte("true")
+	require.Nil(t, api.bdb.Set("legacy", &legacy))
+	entries, err := api.BouncedRecords()
+	require.Nil(t, err)
+	require.Len(t, entries, 2)
+	require.Equal(t, "legacy", entries[0].Key)
+	require.True(t, entries[0].Legacy)
+	require.Equal(t, "legacy - bounced - - - - - -", formatBouncedLine(&entries[0]))
+	require.Equal(t, "audited", entries[1].Key)
+	require.Contains(t, formatBouncedLine(&entries[1]), " sent failed 5.1.1 unknown-user alice@example.com nobody@example.org "+messageID)
+	require.Contains(t, formatBouncedRecord(&entries[1]), "Transport:  recording\n")
+}
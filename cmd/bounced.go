@@ -0,0 +1,144 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-message/textproto"
+	"github.com/spf13/viper"
+)
+
+// BounceRecord is written to the bounced store for each handled failed event
+type BounceRecord struct {
+	Timestamp  time.Time `json:"timestamp"`
+	Sender     string    `json:"sender,omitempty"`
+	Recipient  string    `json:"recipient,omitempty"`
+	Action     string    `json:"action,omitempty"`
+	Status     string    `json:"status,omitempty"`
+	Category   string    `json:"category,omitempty"`
+	Suppressed string    `json:"suppressed,omitempty"`
+	Digest     bool      `json:"digest,omitempty"`
+	Queued     bool      `json:"queued,omitempty"`
+	Transport  string    `json:"transport,omitempty"`
+	MessageID  string    `json:"message_id,omitempty"`
+	Group      []string  `json:"group,omitempty"`
+	Message    string    `json:"message,omitempty"`
+	Legacy     bool      `json:"legacy,omitempty"`
+}
+
+// BouncedEntry is a bounced store record with its event key
+type BouncedEntry struct {
+	Key string `json:"key"`
+	BounceRecord
+}
+
+// newDeliveryRecord returns the delivery details of a sent or queued bounce,
+// including the rendered message when bounce_audit_message is set
+func newDeliveryRecord(transport Transport, message []byte, queued bool) *BounceRecord {
+	record := BounceRecord{Queued: queued}
+	if transport != nil {
+		record.Transport = transport.Name()
+	}
+	header, err := textproto.ReadHeader(bufio.NewReader(bytes.NewReader(message)))
+	if err == nil {
+		record.MessageID = strings.Trim(header.Get("Message-Id"), "<>")
+	}
+	if viper.GetBool("bounce_audit_message") {
+		record.Message = string(message)
+	}
+	return &record
+}
+
+// markSent updates the bounced or complaint records of a message delivered
+// from the retry queue
+func (c *Client) markSent(key string, transport Transport) error {
+	if key != "" && c.cdb.Has(key) {
+		var record ComplaintRecord
+		_, err := c.cdb.GetObject(key, &record)
+		if err != nil {
+			return err
+		}
+		record.Queued = false
+		record.Transport = transport.Name()
+		return c.cdb.SetObject(key, &record)
+	}
+	if key == "" || !c.bdb.Has(key) {
+		return nil
+	}
+	record, err := c.BouncedRecord(key)
+	if err != nil {
+		return err
+	}
+	keys := []string{key}
+	if len(record.Group) > 0 {
+		keys = record.Group
+	}
+	now := time.Now()
+	for _, key := range keys {
+		if !c.bdb.Has(key) {
+			continue
+		}
+		record, err := c.BouncedRecord(key)
+		if err != nil {
+			return err
+		}
+		record.Queued = false
+		record.Timestamp = now
+		record.Transport = transport.Name()
+		err = c.bdb.SetObject(key, record)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// BouncedRecord reads a record from the bounced store; records written
+// before audit records were introduced hold only true and are returned with
+// Legacy set
+func (c *Client) BouncedRecord(key string) (*BounceRecord, error) {
+	data, err := c.bdb.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	if data == nil {
+		return nil, fmt.Errorf("bounced record not found: %s", key)
+	}
+	if strings.TrimSpace(string(*data)) == "true" {
+		return &BounceRecord{Legacy: true}, nil
+	}
+	var record BounceRecord
+	err = json.Unmarshal(*data, &record)
+	if err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// BouncedRecords returns every bounced store record in timestamp order
+func (c *Client) BouncedRecords() ([]BouncedEntry, error) {
+	keys, err := c.bdb.Keys()
+	if err != nil {
+		return nil, err
+	}
+	entries := []BouncedEntry{}
+	for _, key := range keys {
+		record, err := c.BouncedRecord(key)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, BouncedEntry{Key: key, BounceRecord: *record})
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].Timestamp.Equal(entries[j].Timestamp) {
+			return entries[i].Key < entries[j].Key
+		}
+		return entries[i].Timestamp.Before(entries[j].Timestamp)
+	})
+	return entries, nil
+}
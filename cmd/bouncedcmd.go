@@ -0,0 +1,207 @@
+/*
+Copyright © 2025 Matt Krueger <mkrueger@rstms.net>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+ 1. Redistributions of source code must retain the above copyright notice,
+    this list of conditions and the following disclaimer.
+
+ 2. Redistributions in binary form must reproduce the above copyright notice,
+    this list of conditions and the following disclaimer in the documentation
+    and/or other materials provided with the distribution.
+
+ 3. Neither the name of the copyright holder nor the names of its contributors
+    may be used to endorse or promote products derived from this software
+    without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+POSSIBILITY OF SUCH DAMAGE.
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var bouncedShowMessage bool
+
+var bouncedCmd = &cobra.Command{
+	Use:   "bounced",
+	Short: "bounce audit records",
+	Long: `
+Inspect the mailgun.bounced store, which holds a record for each failed
+event the bounce pipeline has handled: when it was handled, the sender the
+bounce was addressed to, the DSN action and status, the transport and the
+Message-ID of the generated bounce.  With bounce_audit_message set the
+rendered bounce is recorded too.
+`,
+}
+
+var bouncedListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "list bounce audit records",
+	Long: `
+List the bounced store records in the order they were written, one line
+per record, or in the format selected by --output.
+`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		api := NewClient()
+		entries, err := api.BouncedRecords()
+		cobra.CheckErr(err)
+		format := OutputFormat(OutputText)
+		if format == OutputText {
+			for _, entry := range entries {
+				fmt.Println(formatBouncedLine(&entry))
+			}
+			return
+		}
+		output, err := NewOutput(os.Stdout, format, bouncedColumns, false)
+		cobra.CheckErr(err)
+		for _, entry := range entries {
+			entry.Message = ""
+			cobra.CheckErr(output.Write(entry, bouncedRow(&entry)))
+		}
+		cobra.CheckErr(output.Close())
+	},
+}
+
+var bouncedShowCmd = &cobra.Command{
+	Use:   "show EVENT_ID",
+	Short: "show a bounce audit record",
+	Long: `
+Show the bounced store record for an event in the format selected by
+--output, or with --message write the recorded bounce message to stdout.
+`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		api := NewClient()
+		record, err := api.BouncedRecord(args[0])
+		cobra.CheckErr(err)
+		if bouncedShowMessage {
+			if record.Message == "" {
+				cobra.CheckErr(fmt.Errorf("no message recorded for %s", args[0]))
+			}
+			_, err := os.Stdout.WriteString(record.Message)
+			cobra.CheckErr(err)
+			return
+		}
+		entry := BouncedEntry{Key: args[0], BounceRecord: *record}
+		format := OutputFormat(OutputText)
+		if format == OutputText {
+			fmt.Print(formatBouncedRecord(&entry))
+			return
+		}
+		output, err := NewOutput(os.Stdout, format, bouncedColumns, false)
+		cobra.CheckErr(err)
+		cobra.CheckErr(output.Write(entry, bouncedRow(&entry)))
+		cobra.CheckErr(output.Close())
+	},
+}
+
+// bouncedResult summarizes what happened to the bounce for a record
+func bouncedResult(entry *BouncedEntry) string {
+	switch {
+	case entry.Legacy:
+		return "bounced"
+	case entry.Suppressed != "":
+		return "suppressed"
+	case entry.Digest:
+		return "digest"
+	case entry.Queued:
+		return "queued"
+	case entry.Action != "":
+		return "sent"
+	}
+	return "skipped"
+}
+
+var bouncedColumns = []string{"key", "timestamp", "result", "action", "status", "category", "sender", "recipient", "message_id", "suppressed"}
+
+// bouncedRow returns the table column values for a record
+func bouncedRow(entry *BouncedEntry) map[string]string {
+	timestamp := ""
+	if !entry.Timestamp.IsZero() {
+		timestamp = entry.Timestamp.Format(time.RFC3339)
+	}
+	return map[string]string{
+		"key":        entry.Key,
+		"timestamp":  timestamp,
+		"result":     bouncedResult(entry),
+		"action":     entry.Action,
+		"status":     entry.Status,
+		"category":   entry.Category,
+		"sender":     entry.Sender,
+		"recipient":  entry.Recipient,
+		"message_id": entry.MessageID,
+		"suppressed": entry.Suppressed,
+	}
+}
+
+func formatBouncedLine(entry *BouncedEntry) string {
+	timestamp := "-"
+	if !entry.Timestamp.IsZero() {
+		timestamp = entry.Timestamp.Format(time.RFC3339)
+	}
+	fields := []string{entry.Key, timestamp, bouncedResult(entry)}
+	for _, value := range []string{entry.Action, entry.Status, entry.Category, entry.Sender, entry.Recipient, entry.MessageID} {
+		if value == "" {
+			value = "-"
+		}
+		fields = append(fields, value)
+	}
+	if entry.Suppressed != "" {
+		fields = append(fields, fmt.Sprintf("(%s)", entry.Suppressed))
+	}
+	return strings.Join(fields, " ")
+}
+
+func formatBouncedRecord(entry *BouncedEntry) string {
+	var b strings.Builder
+	field := func(name, value string) {
+		if value != "" {
+			fmt.Fprintf(&b, "%-11s %s\n", name+":", value)
+		}
+	}
+	field("Event", entry.Key)
+	field("Result", bouncedResult(entry))
+	if !entry.Timestamp.IsZero() {
+		field("Timestamp", entry.Timestamp.Format(time.RFC3339))
+	}
+	field("Sender", entry.Sender)
+	field("Recipient", entry.Recipient)
+	field("Action", entry.Action)
+	field("Status", entry.Status)
+	field("Category", entry.Category)
+	field("Suppressed", entry.Suppressed)
+	field("Transport", entry.Transport)
+	field("Message-ID", entry.MessageID)
+	field("Group", strings.Join(entry.Group, " "))
+	if entry.Message != "" {
+		field("Message", fmt.Sprintf("%d bytes", len(entry.Message)))
+	}
+	return b.String()
+}
+
+func init() {
+	rootCmd.AddCommand(bouncedCmd)
+	bouncedCmd.AddCommand(bouncedListCmd)
+	bouncedCmd.AddCommand(bouncedShowCmd)
+	bouncedShowCmd.Flags().BoolVarP(&bouncedShowMessage, "message", "m", false, "write the recorded bounce message")
+}
@@ -31,31 +31,58 @@ POSSIBILITY OF SUCH DAMAGE.
 package cmd
 
 import (
-	"fmt"
+	"os"
+
+	"github.com/mailgun/mailgun-go/v5/mtypes"
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 )
 
+var bouncesColumns string
+var bouncesNoHeader bool
+
+var bounceColumns = []string{"address", "code", "error", "created_at"}
+
 var bouncesCmd = &cobra.Command{
 	Use:   "bounces",
 	Short: "query bounce addresses",
 	Long: `
 List the mailgun account persistent list of bounced addresses.
+
+By default the bounces are written as a table; --columns selects from
+address, code, error and created_at for table and csv output.  Table
+columns are truncated to fit the terminal width.
 `,
 	Run: func(cmd *cobra.Command, args []string) {
+		columns, err := SelectColumns(bouncesColumns, bounceColumns, bounceColumns)
+		cobra.CheckErr(err)
 		api := NewClient()
 		bounces, err := api.QueryBounceAddrs()
 		cobra.CheckErr(err)
-		if viper.GetBool("json") {
-			fmt.Println(FormatJSON(bounces))
-		} else {
-			for _, bounce := range *bounces {
-				fmt.Println(bounce.Address)
-			}
+		output, err := NewOutput(os.Stdout, OutputFormat(OutputText), columns, bouncesNoHeader)
+		cobra.CheckErr(err)
+		for _, bounce := range *bounces {
+			cobra.CheckErr(output.Write(bounce, bounceRow(&bounce)))
 		}
+		cobra.CheckErr(output.Close())
 	},
 }
 
+// bounceRow returns the table column values for a bounced address
+func bounceRow(bounce *mtypes.Bounce) map[string]string {
+	createdAt := ""
+	if !bounce.CreatedAt.IsZero() {
+		createdAt = bounce.CreatedAt.String()
+	}
+	return map[string]string{
+		"address":    bounce.Address,
+		"code":       bounce.Code,
+		"error":      bounce.Error,
+		"created_at": createdAt,
+	}
+}
+
 func init() {
 	rootCmd.AddCommand(bouncesCmd)
+	bouncesCmd.Flags().StringVarP(&bouncesColumns, "columns", "C", "", "comma separated table columns")
+	bouncesCmd.Flags().BoolVar(&bouncesNoHeader, "no-header", false, "omit the table header")
 }
@@ -0,0 +1,159 @@
+package cmd
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/mailgun/mailgun-go/v5/events"
+	"github.com/spf13/viper"
+)
+
+// bounce categories assigned by the built-in rules
+const (
+	CategoryMailboxFull  = "mailbox-full"
+	CategoryUnknownUser  = "unknown-user"
+	CategoryPolicy       = "policy"
+	CategoryDNS          = "dns"
+	CategoryThrottle     = "throttle"
+	CategoryUnclassified = "unclassified"
+)
+
+// ClassifyRule assigns a category to failures matching every criterion it
+// sets: an enhanced status code or prefix, where an x class matches both 4
+// and 5; an SMTP reply code; a mailgun reason; and a case-insensitive regular
+// expression matched against the delivery status message and description
+type ClassifyRule struct {
+	Category string `mapstructure:"category" json:"category"`
+	Status   string `mapstructure:"status" json:"status,omitempty"`
+	Code     int    `mapstructure:"code" json:"code,omitempty"`
+	Reason   string `mapstructure:"reason" json:"reason,omitempty"`
+	Pattern  string `mapstructure:"pattern" json:"pattern,omitempty"`
+	pattern  *regexp.Regexp
+}
+
+var defaultClassifyRules = []ClassifyRule{
+	{Category: CategoryMailboxFull, Status: "x.2.2"},
+	{Category: CategoryUnknownUser, Status: "x.1.1"},
+	{Category: CategoryUnknownUser, Status: "x.1.6"},
+	{Category: CategoryUnknownUser, Status: "x.2.1"},
+	{Category: CategoryDNS, Status: "x.1.2"},
+	{Category: CategoryDNS, Status: "x.4.3"},
+	{Category: CategoryDNS, Status: "x.4.4"},
+	{Category: CategoryThrottle, Status: "4.7.28"},
+	{Category: CategoryThrottle, Status: "x.4.5"},
+	{Category: CategoryThrottle, Status: "x.3.2"},
+	{Category: CategoryPolicy, Status: "x.7"},
+	{Category: CategoryPolicy, Reason: "espblock"},
+	{Category: CategoryMailboxFull, Pattern: `mailbox (is )?full|over ?quota|quota exceeded|insufficient (system )?storage|exceeded storage`},
+	{Category: CategoryUnknownUser, Pattern: `user unknown|unknown (user|recipient)|no such (user|mailbox|recipient)|does not exist|recipient not found|invalid (mailbox|recipient)|mailbox (unavailable|not found)|address rejected`},
+	{Category: CategoryPolicy, Pattern: `dnsbl|\brbl\b|blocked using|spamhaus`},
+	{Category: CategoryDNS, Pattern: `dns|domain not found|no mx|host not found|nxdomain|unroutable|name or service not known|no route to host`},
+	{Category: CategoryThrottle, Pattern: `rate limit|too many (messages|connections|recipients)|throttl|try again later|temporarily deferred|exceeded .*(rate|limit)`},
+	{Category: CategoryPolicy, Pattern: `spam|blocked|block ?list|black ?list|listed|policy|reputation|dmarc|spf|dkim`},
+	{Category: CategoryThrottle, Code: 421},
+}
+
+// compile prepares the rule pattern
+func (r *ClassifyRule) compile() error {
+	if r.Category == "" {
+		return fmt.Errorf("bounce_classes: rule without category")
+	}
+	if r.Status == "" && r.Code == 0 && r.Reason == "" && r.Pattern == "" {
+		return fmt.Errorf("bounce_classes: rule for %s has no criteria", r.Category)
+	}
+	if r.Pattern != "" {
+		pattern, err := regexp.Compile("(?i)" + r.Pattern)
+		if err != nil {
+			return fmt.Errorf("bounce_classes: %s: %v", r.Category, err)
+		}
+		r.pattern = pattern
+	}
+	return nil
+}
+
+func (r *ClassifyRule) match(status string, code int, reason, text string) bool {
+	if r.Status != "" && !matchStatus(r.Status, status) {
+		return false
+	}
+	if r.Code != 0 && r.Code != code {
+		return false
+	}
+	if r.Reason != "" && !strings.EqualFold(r.Reason, reason) {
+		return false
+	}
+	if r.pattern != nil && !r.pattern.MatchString(text) {
+		return false
+	}
+	return true
+}
+
+// matchStatus reports whether an enhanced status code matches a rule status
+// of one to three components, where the class may be x
+func matchStatus(rule, status string) bool {
+	ruleParts := strings.Split(strings.ToLower(rule), ".")
+	statusParts := strings.Split(status, ".")
+	if len(ruleParts) > len(statusParts) {
+		return false
+	}
+	for i, part := range ruleParts {
+		if i == 0 && part == "x" {
+			continue
+		}
+		if part != statusParts[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Classifier maps delivery failures to bounce categories using the rules
+// from the bounce_classes config key followed by the built-in rules
+type Classifier struct {
+	rules []ClassifyRule
+}
+
+// NewClassifier compiles the configured and built-in rules
+func NewClassifier() (*Classifier, error) {
+	rules := []ClassifyRule{}
+	err := viper.UnmarshalKey("bounce_classes", &rules)
+	if err != nil {
+		return nil, fmt.Errorf("bounce_classes: %v", err)
+	}
+	rules = append(rules, defaultClassifyRules...)
+	for i := range rules {
+		err := rules[i].compile()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &Classifier{rules: rules}, nil
+}
+
+// Classify returns the category of a failed event
+func (c *Classifier) Classify(event *events.Failed) string {
+	status := event.DeliveryStatus.EnhancedCode
+	if status == "" {
+		status = enhancedCodeFromText(event.DeliveryStatus.Message)
+	}
+	text := event.DeliveryStatus.Message + " " + event.DeliveryStatus.Description
+	for i := range c.rules {
+		if c.rules[i].match(status, event.DeliveryStatus.Code, event.Reason, text) {
+			return c.rules[i].Category
+		}
+	}
+	return CategoryUnclassified
+}
+
+var enhancedCodePattern = regexp.MustCompile(`\b[245]\.\d{1,3}\.\d{1,3}\b`)
+
+// enhancedCodeFromText finds an enhanced status code quoted in a reply text
+func enhancedCodeFromText(text string) string {
+	return enhancedCodePattern.FindString(text)
+}
+
+// ValidateClassifier checks the bounce_classes rules
+func ValidateClassifier() error {
+	_, err := NewClassifier()
+	return err
+}
@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/mailgun/mailgun-go/v5/events"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+)
+
+func classifyEvent(code int, enhanced, message, reason string) *events.Failed {
+	var failed events.Failed
+	failed.DeliveryStatus.Code = code
+	failed.DeliveryStatus.EnhancedCode = enhanced
+	failed.DeliveryStatus.Message = message
+	failed.Reason = reason
+	return &failed
+}
+
+func TestClassify(t *testing.T) {
+	initTestConfig()
+	classifier, err := NewClassifier()
+	require.Nil(t, err)
+	cases := []struct {
+		event    *events.Failed
+		expected string
+	}{
+		{classifyEvent(550, "5.1.1", "The email account that you tried to reach does not exist.", "bounce"), CategoryUnknownUser},
+		{classifyEvent(550, "", "5.1.1 <bob@example.org>: Recipient address rejected: User unknown", "bounce"), CategoryUnknownUser},
+		{classifyEvent(550, "", "No such user here", "bounce"), CategoryUnknownUser},
+		{classifyEvent(452, "4.2.2", "The email account that you tried to reach is over quota.", "generic"), CategoryMailboxFull},
+		{classifyEvent(552, "", "Mailbox full", "bounce"), CategoryMailboxFull},
+		{classifyEvent(554, "5.7.1", "Service unavailable; Client host [192.0.2.10] blocked using zen.spamhaus.org", "bounce"), CategoryPolicy},
+		{classifyEvent(550, "", "Message rejected as spam", "bounce"), CategoryPolicy},
+		{classifyEvent(554, "", "Client host blocked using DNSBL zen.spamhaus.org", "bounce"), CategoryPolicy},
+		{classifyEvent(550, "", "Rejected: sender listed in RBL", "bounce"), CategoryPolicy},
+		{classifyEvent(605, "", "Not delivering to previously bounced address", "espblock"), CategoryPolicy},
+		{classifyEvent(498, "", "No MX for example.invalid", "generic"), CategoryDNS},
+		{classifyEvent(550, "5.1.2", "Host unknown", "bounce"), CategoryDNS},
+		{classifyEvent(421, "4.7.28", "Our system has detected an unusual rate of unsolicited mail", "generic"), CategoryThrottle},
+		{classifyEvent(450, "", "Too many connections, try again later", "generic"), CategoryThrottle},
+		{classifyEvent(421, "", "Service not available", "generic"), CategoryThrottle},
+		{classifyEvent(500, "", "Syntax error", "generic"), CategoryUnclassified},
+	}
+	for _, tc := range cases {
+		require.Equal(t, tc.expected, classifier.Classify(tc.event), tc.event.DeliveryStatus.Message)
+	}
+}
+
+func TestClassifyConfig(t *testing.T) {
+	initTestConfig()
+	defer viper.Set("bounce_classes", nil)
+
+	viper.Set("bounce_classes", []map[string]any{
+		{"category": "greylisted", "code": 451, "pattern": "greylist"},
+		{"category": "mailbox-disabled", "status": "x.2.1"},
+	})
+	classifier, err := NewClassifier()
+	require.Nil(t, err)
+	require.Equal(t, "greylisted", classifier.Classify(classifyEvent(451, "4.7.1", "Greylisted, please try again", "generic")))
+	require.Equal(t, CategoryPolicy, classifier.Classify(classifyEvent(450, "4.7.1", "Greylisted, please try again", "generic")))
+	require.Equal(t, "mailbox-disabled", classifier.Classify(classifyEvent(550, "5.2.1", "Account disabled", "bounce")))
+
+	viper.Set("bounce_classes", []map[string]any{{"category": "broken", "pattern": "("}})
+	require.ErrorContains(t, ValidateClassifier(), "broken")
+	viper.Set("bounce_classes", []map[string]any{{"category": "empty"}})
+	require.ErrorContains(t, ValidateClassifier(), "no criteria")
+	viper.Set("bounce_classes", []map[string]any{{"status": "5.1.1"}})
+	require.ErrorContains(t, ValidateClassifier(), "without category")
+}
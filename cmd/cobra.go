@@ -50,6 +50,18 @@ func OptionString(name, flag, defaultValue, description string) {
 	viper.BindPFlag(ViperKey(name), rootCmd.PersistentFlags().Lookup(name))
 }
 
+// DomainString returns the value of key from the domains config map entry
+// for domain, falling back to the global value
+func DomainString(domain, key string) string {
+	domains := viper.GetStringMap("domains")
+	if config, ok := domains[strings.ToLower(domain)].(map[string]any); ok {
+		if value, ok := config[ViperKey(key)]; ok && value != nil {
+			return fmt.Sprintf("%v", value)
+		}
+	}
+	return viper.GetString(ViperKey(key))
+}
+
 func InitLog() {
 	filename := viper.GetString("logfile")
 	logFile = nil
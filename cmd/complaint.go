@@ -0,0 +1,211 @@
+package cmd
+
+import (
+	"bytes"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-message"
+	"github.com/emersion/go-message/mail"
+	"github.com/emersion/go-message/textproto"
+	"github.com/mailgun/mailgun-go/v5/events"
+	"github.com/spf13/viper"
+)
+
+// ComplaintRecord is written to the complaints store for each handled
+// complained event
+type ComplaintRecord struct {
+	Timestamp  time.Time `json:"timestamp"`
+	Recipient  string    `json:"recipient"`
+	MessageID  string    `json:"message_id,omitempty"`
+	ReportTo   string    `json:"report_to,omitempty"`
+	Suppressed string    `json:"suppressed,omitempty"`
+	Queued     bool      `json:"queued,omitempty"`
+	Transport  string    `json:"transport,omitempty"`
+	ReportID   string    `json:"report_id,omitempty"`
+}
+
+// complaintReportTo returns the address a complaint report is sent to: the
+// complaint_report_to address, or the original sender when it is unset or
+// set to "sender"
+func (c *Client) complaintReportTo(event *events.Complained) string {
+	to := DomainString(c.domain, "complaint_report_to")
+	if to != "" && to != "sender" {
+		return to
+	}
+	from, err := mail.ParseAddress(event.Message.Headers.From)
+	if err != nil {
+		return ""
+	}
+	return from.Address
+}
+
+// SendComplaintReports sends an RFC 5965 feedback report for each complained
+// event in the events store that is not yet in the complaints store
+func (c *Client) SendComplaintReports() error {
+	keys, err := c.edb.Keys()
+	if err != nil {
+		return err
+	}
+	complaints := []*events.Complained{}
+	for _, key := range keys {
+		if c.cdb.Has(key) {
+			continue
+		}
+		event, err := c.loadEvent(key)
+		if err != nil {
+			return err
+		}
+		if complained, ok := event.(*events.Complained); ok {
+			complaints = append(complaints, complained)
+		}
+	}
+	sort.Slice(complaints, func(i, j int) bool {
+		return complaints[i].Timestamp < complaints[j].Timestamp
+	})
+	for _, complained := range complaints {
+		record, err := c.sendComplaintReport(complained)
+		if err != nil {
+			return err
+		}
+		err = c.cdb.SetObject(complained.GetID(), record)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Client) sendComplaintReport(event *events.Complained) (*ComplaintRecord, error) {
+	key := event.GetID()
+	messageID := event.Message.Headers.MessageID
+	record := ComplaintRecord{
+		Timestamp: time.Now(),
+		Recipient: event.Recipient,
+		MessageID: messageID,
+		ReportTo:  c.complaintReportTo(event),
+	}
+	reason := senderSuppressReason(record.ReportTo)
+	if reason != "" {
+		if !viper.GetBool("quiet") {
+			log.Printf("suppressed_complaint_report: %s <%s> %s %s\n", key, messageID, event.Recipient, reason)
+		}
+		record.Suppressed = reason
+		return &record, nil
+	}
+	var buf bytes.Buffer
+	err := c.formatComplaintReport(event, record.ReportTo, &buf)
+	if err != nil {
+		return nil, err
+	}
+	data, err := c.signBounce(buf.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	queued, err := c.deliverMessage(key, record.ReportTo, data)
+	if err != nil {
+		return nil, err
+	}
+	delivery := newDeliveryRecord(c.transport, data, queued)
+	record.Queued = queued
+	record.Transport = delivery.Transport
+	record.ReportID = delivery.MessageID
+	if !viper.GetBool("quiet") && !queued {
+		log.Printf("sent_complaint_report: %s <%s> %s to %s\n", key, messageID, event.Recipient, record.ReportTo)
+	}
+	return &record, nil
+}
+
+// formatComplaintReport writes an RFC 5965 abuse report for a complained
+// event as a multipart/report message with a human-readable part, a
+// message/feedback-report part and the original message headers
+func (c *Client) formatComplaintReport(event *events.Complained, to string, buf *bytes.Buffer) error {
+
+	identity, err := LoadBounceIdentity(c.domain)
+	if err != nil {
+		return err
+	}
+
+	complaintTemplate, err := LoadBounceTemplate(c.domain, "complaint")
+	if err != nil {
+		return err
+	}
+	subject, text, html, err := complaintTemplate.Render(&ComplaintData{
+		Complained: event,
+		Domain:     c.domain,
+		Hostname:   identity.ReportingMTA,
+	})
+	if err != nil {
+		return err
+	}
+
+	writer, err := c.createReport(buf, identity, to, subject, "feedback-report")
+	if err != nil {
+		return err
+	}
+
+	err = c.addHumanPart(writer, text, html)
+	if err != nil {
+		return err
+	}
+
+	err = c.addFeedbackReportPart(writer, identity.ReportingMTA, event)
+	if err != nil {
+		return err
+	}
+
+	var headers bytes.Buffer
+	err = textproto.WriteHeader(&headers, originalHeaders(&event.Message.Headers).Header.Header)
+	if err != nil {
+		return err
+	}
+	err = c.addPart(writer, "text/rfc822-headers", nil, &headers)
+	if err != nil {
+		return err
+	}
+
+	return writer.Close()
+}
+
+// addFeedbackReportPart writes the message/feedback-report part
+func (c *Client) addFeedbackReportPart(writer *message.Writer, reportingMTA string, event *events.Complained) error {
+	var buf bytes.Buffer
+	writeDSNField(&buf, "Feedback-Type", "abuse")
+	writeDSNField(&buf, "User-Agent", "mailgun/"+Version)
+	writeDSNField(&buf, "Version", "1")
+	from, err := mail.ParseAddress(event.Message.Headers.From)
+	if err == nil {
+		writeDSNField(&buf, "Original-Mail-From", "<"+normalizeAddress(from.Address)+">")
+		_, domain, ok := strings.Cut(from.Address, "@")
+		if ok {
+			writeDSNField(&buf, "Reported-Domain", asciiHostname(domain))
+		}
+	}
+	writeDSNField(&buf, "Original-Rcpt-To", "<"+normalizeAddress(event.Recipient)+">")
+	arrival := c.arrivalDate(event.Message.Headers.MessageID, event.GetTimestamp())
+	if !arrival.IsZero() {
+		writeDSNField(&buf, "Arrival-Date", arrival.Format(time.RFC1123Z))
+	}
+	writeDSNField(&buf, "Reporting-MTA", "dns; "+reportingMTA)
+	return c.addPart(writer, "message/feedback-report", nil, &buf)
+}
+
+// PruneComplaints removes complaint records whose event is no longer in the
+// events store
+func (c *Client) PruneComplaints() error {
+	keys, err := c.cdb.Keys()
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if !c.edb.Has(key) {
+			err := c.cdb.Clear(key)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
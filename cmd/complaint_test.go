@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/emersion/go-message"
+	"github.com/mailgun/mailgun-go/v5/events"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+)
+
+func TestComplaintReport(t *testing.T) {
+	api, transport := newTestClient(t)
+	complained := loadTestEvent(t, "complained.json").(*events.Complained)
+	require.Nil(t, api.storeEvent(complained))
+	require.Nil(t, api.storeEvent(&events.Accepted{
+		Generic: events.Generic{EventName: events.EventName{Name: events.EventAccepted}, ID: "accepted-1", Timestamp: complained.Timestamp - 3600},
+		Message: events.Message{Headers: events.MessageHeaders{MessageID: complained.Message.Headers.MessageID}},
+	}))
+
+	require.Nil(t, api.SendComplaintReports())
+	require.Len(t, transport.messages, 1)
+	sent := transport.messages[0]
+	require.Equal(t, []string{"alice@example.com"}, sent.Recipients)
+
+	entity, err := message.Read(bytes.NewReader(sent.Data))
+	require.Nil(t, err)
+	contentType, params, err := entity.Header.ContentType()
+	require.Nil(t, err)
+	require.Equal(t, "multipart/report", contentType)
+	require.Equal(t, "feedback-report", params["report-type"])
+	require.Equal(t, "auto-generated", entity.Header.Get("Auto-Submitted"))
+	require.Equal(t, "Abuse report: Quarterly report", entity.Header.Get("Subject"))
+
+	parts := readBounceParts(t, bytes.NewBuffer(sent.Data))
+	report := parts["message/feedback-report"]
+	for _, field := range []string{
+		"Feedback-Type: abuse",
+		"Version: 1",
+		"Original-Mail-From: <alice@example.com>",
+		"Original-Rcpt-To: <carol@example.org>",
+		"Reported-Domain: example.com",
+		"Arrival-Date: Thu, 16 Oct 2025 12:00:00 +0000",
+	} {
+		require.Contains(t, report, field+"\r\n")
+	}
+	require.True(t, strings.HasPrefix(report, "Feedback-Type: "))
+	require.Contains(t, parts["text/plain"], "The recipient carol@example.org reported")
+	require.Contains(t, parts["text/rfc822-headers"], "Message-Id: <20251016130000.1.FEDCBA@example.com>")
+
+	var record ComplaintRecord
+	_, err = api.cdb.GetObject(complained.ID, &record)
+	require.Nil(t, err)
+	require.Equal(t, "alice@example.com", record.ReportTo)
+	require.Equal(t, "recording", record.Transport)
+	require.NotEmpty(t, record.ReportID)
+
+	// each complaint is reported once
+	require.Nil(t, api.SendComplaintReports())
+	require.Len(t, transport.messages, 1)
+}
+
+func TestComplaintReportTo(t *testing.T) {
+	api, transport := newTestClient(t)
+	viper.Set("domains", map[string]any{api.domain: map[string]any{"complaint_report_to": "abuse@example.net"}})
+	defer viper.Set("domains", nil)
+
+	complained := loadTestEvent(t, "complained.json").(*events.Complained)
+	require.Nil(t, api.storeEvent(complained))
+	noreply := loadTestEvent(t, "complained.json").(*events.Complained)
+	noreply.ID = "noreply"
+	noreply.Message.Headers.From = "<noreply@example.com>"
+	require.Nil(t, api.storeEvent(noreply))
+
+	require.Nil(t, api.SendComplaintReports())
+	require.Len(t, transport.messages, 2)
+	for _, sent := range transport.messages {
+		require.Equal(t, []string{"abuse@example.net"}, sent.Recipients)
+		// no accepted event is stored for the message
+		require.NotContains(t, readBounceParts(t, bytes.NewBuffer(sent.Data))["message/feedback-report"], "Arrival-Date")
+	}
+
+	viper.Set("domains", nil)
+	require.Nil(t, api.cdb.Reset())
+	transport.messages = nil
+	require.Nil(t, api.SendComplaintReports())
+	require.Len(t, transport.messages, 1)
+	var record ComplaintRecord
+	_, err := api.cdb.GetObject("noreply", &record)
+	require.Nil(t, err)
+	require.Equal(t, "sender local part noreply", record.Suppressed)
+}
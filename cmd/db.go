@@ -30,7 +30,7 @@ func NewDB(dir, name string) *DB {
 		dir = filepath.Join(home, dir)
 	}
 	if !IsDir(dir) {
-		err := os.Mkdir(dir, 0700)
+		err := os.MkdirAll(dir, 0700)
 		if err != nil {
 			log.Fatalf("NewDB: %v", err)
 		}
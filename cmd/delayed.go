@@ -0,0 +1,170 @@
+package cmd
+
+import (
+	"log"
+	"strings"
+	"time"
+
+	"github.com/mailgun/mailgun-go/v5/events"
+	"github.com/spf13/viper"
+)
+
+// DelayedRecord tracks a message/recipient pair that has received a delayed
+// delivery warning
+type DelayedRecord struct {
+	EventKey     string    `json:"event_key"`
+	MessageID    string    `json:"message_id"`
+	Recipient    string    `json:"recipient"`
+	FirstFailure time.Time `json:"first_failure"`
+	Warned       time.Time `json:"warned"`
+	Final        bool      `json:"final"`
+}
+
+// deliveryKey identifies a message/recipient pair in the delayed store
+func deliveryKey(messageID, recipient string) string {
+	return strings.Trim(messageID, "<>") + " " + strings.ToLower(recipient)
+}
+
+// failureAction returns the DSN action due for a failed event, or an empty
+// string if none is: temporary failures produce at most one delayed warning
+// per message/recipient, permanent failures produce a failure bounce unless
+// one was already sent for an expired delay
+func (c *Client) failureAction(key string, failed *events.Failed, delivered map[string]bool) (string, error) {
+	dkey := deliveryKey(failed.Message.Headers.MessageID, failed.Recipient)
+	var record DelayedRecord
+	hasRecord := c.ddb.Has(dkey)
+	if hasRecord {
+		_, err := c.ddb.GetObject(dkey, &record)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if failed.Severity == "temporary" {
+		if hasRecord || delivered[dkey] {
+			if viper.GetBool("verbose") {
+				log.Printf("skip_delay_warning: %s <%s> %s\n", key, failed.Message.Headers.MessageID, failed.Recipient)
+			}
+			return "", nil
+		}
+		return "delayed", nil
+	}
+
+	if hasRecord && record.Final {
+		if viper.GetBool("verbose") {
+			log.Printf("skip_bounce: %s <%s> %s\n", key, failed.Message.Headers.MessageID, failed.Recipient)
+		}
+		return "", nil
+	}
+	return "failed", nil
+}
+
+// recordDelayed updates the delayed store after a DSN was handled: a sent
+// delayed warning starts tracking the message/recipient, and a failure
+// bounce marks any tracked message/recipient final
+func (c *Client) recordDelayed(item bounceItem, bounced *BounceRecord) error {
+	dkey := deliveryKey(item.event.Message.Headers.MessageID, item.event.Recipient)
+	if item.action == "delayed" {
+		if bounced.Suppressed != "" {
+			return nil
+		}
+		record := DelayedRecord{
+			EventKey:     item.key,
+			MessageID:    item.event.Message.Headers.MessageID,
+			Recipient:    item.event.Recipient,
+			FirstFailure: item.event.GetTimestamp(),
+			Warned:       time.Now(),
+		}
+		return c.ddb.SetObject(dkey, &record)
+	}
+	if !c.ddb.Has(dkey) {
+		return nil
+	}
+	var record DelayedRecord
+	_, err := c.ddb.GetObject(dkey, &record)
+	if err != nil {
+		return err
+	}
+	record.Final = true
+	return c.ddb.SetObject(dkey, &record)
+}
+
+// expireDelayed sends a failure bounce for each delayed message/recipient
+// that has neither been delivered nor permanently failed within the
+// delay_bounce_after interval; an interval of 0 disables expiry
+func (c *Client) expireDelayed(delivered map[string]bool, accepted map[string]time.Time) error {
+	threshold := viper.GetDuration("delay_bounce_after")
+	if threshold <= 0 {
+		return nil
+	}
+	keys, err := c.ddb.Keys()
+	if err != nil {
+		return err
+	}
+	expired := []failedEvent{}
+	for _, dkey := range keys {
+		var record DelayedRecord
+		_, err := c.ddb.GetObject(dkey, &record)
+		if err != nil {
+			return err
+		}
+		if record.Final || delivered[dkey] || time.Since(record.FirstFailure) < threshold {
+			continue
+		}
+		if !c.edb.Has(record.EventKey) {
+			continue
+		}
+		event, err := c.loadEvent(record.EventKey)
+		if err != nil {
+			return err
+		}
+		failed, ok := event.(*events.Failed)
+		if !ok {
+			continue
+		}
+		if !viper.GetBool("quiet") {
+			log.Printf("delay_expired: %s <%s> %s\n", record.EventKey, record.MessageID, record.Recipient)
+		}
+		expired = append(expired, failedEvent{record.EventKey, failed})
+	}
+	for _, group := range groupFailures(expired, 0) {
+		items := []bounceItem{}
+		for _, failure := range group {
+			items = append(items, bounceItem{failure.key, failure.event, "failed"})
+		}
+		bounced, err := c.deliverBounce(items, accepted)
+		if err != nil {
+			return err
+		}
+		for _, item := range items {
+			err := c.recordDelayed(item, bounced)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// PruneDelayed removes delayed records whose warning event is no longer in
+// the events store
+func (c *Client) PruneDelayed() error {
+	keys, err := c.ddb.Keys()
+	if err != nil {
+		return err
+	}
+	for _, dkey := range keys {
+		var record DelayedRecord
+		_, err := c.ddb.GetObject(dkey, &record)
+		if err != nil {
+			return err
+		}
+		if !c.edb.Has(record.EventKey) {
+			err := c.ddb.Clear(dkey)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
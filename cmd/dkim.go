@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+
+	"github.com/emersion/go-msgauth/dkim"
+)
+
+// dkimHeaderKeys are the header fields covered by bounce signatures
+var dkimHeaderKeys = []string{
+	"From",
+	"To",
+	"Subject",
+	"Date",
+	"Message-ID",
+	"Auto-Submitted",
+	"MIME-Version",
+	"Content-Type",
+}
+
+// DKIMOptions returns the signing options for the domain's bounces, or nil
+// when dkim_key is not configured; dkim_domain defaults to the domain
+func DKIMOptions(domain string) (*dkim.SignOptions, error) {
+	keyFile := DomainString(domain, "dkim_key")
+	if keyFile == "" {
+		return nil, nil
+	}
+	selector := DomainString(domain, "dkim_selector")
+	if selector == "" {
+		return nil, fmt.Errorf("dkim_key is set without dkim_selector for %s", domain)
+	}
+	signingDomain := DomainString(domain, "dkim_domain")
+	if signingDomain == "" {
+		signingDomain = domain
+	}
+	signer, err := loadDKIMKey(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	return &dkim.SignOptions{
+		Domain:                 signingDomain,
+		Selector:               selector,
+		Signer:                 signer,
+		Hash:                   crypto.SHA256,
+		HeaderCanonicalization: dkim.CanonicalizationRelaxed,
+		BodyCanonicalization:   dkim.CanonicalizationRelaxed,
+		HeaderKeys:             dkimHeaderKeys,
+	}, nil
+}
+
+// loadDKIMKey reads a PEM encoded RSA or Ed25519 private key in PKCS#1 or
+// PKCS#8 form
+func loadDKIMKey(pathname string) (crypto.Signer, error) {
+	data, err := os.ReadFile(pathname)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("dkim key %s: no PEM data", pathname)
+	}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("dkim key %s: %v", pathname, err)
+		}
+		return key, nil
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("dkim key %s: %v", pathname, err)
+		}
+		switch key := key.(type) {
+		case *rsa.PrivateKey:
+			return key, nil
+		case ed25519.PrivateKey:
+			return key, nil
+		}
+		return nil, fmt.Errorf("dkim key %s: unsupported key type %T", pathname, key)
+	}
+	return nil, fmt.Errorf("dkim key %s: unsupported PEM block %s", pathname, block.Type)
+}
+
+// signBounce adds a DKIM-Signature header to a formatted bounce when signing
+// is configured for the client's domain, otherwise the message is returned
+// unchanged
+func (c *Client) signBounce(message []byte) ([]byte, error) {
+	options, err := DKIMOptions(c.domain)
+	if err != nil {
+		return nil, err
+	}
+	if options == nil {
+		return message, nil
+	}
+	var signed bytes.Buffer
+	err = dkim.Sign(&signed, bytes.NewReader(message), options)
+	if err != nil {
+		return nil, fmt.Errorf("dkim signing failed: %v", err)
+	}
+	return signed.Bytes(), nil
+}
@@ -0,0 +1,139 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/emersion/go-msgauth/dkim"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+)
+
+// writeDKIMKey writes a PEM private key file and returns its path and the
+// DNS TXT record publishing the public key
+func writeDKIMKey(t *testing.T, keyType string) (string, string) {
+	var block *pem.Block
+	var public crypto.PublicKey
+	switch keyType {
+	case "rsa":
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		require.Nil(t, err)
+		block = &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}
+		public = &key.PublicKey
+	case "ed25519":
+		pub, key, err := ed25519.GenerateKey(rand.Reader)
+		require.Nil(t, err)
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		require.Nil(t, err)
+		block = &pem.Block{Type: "PRIVATE KEY", Bytes: der}
+		public = pub
+	}
+	pathname := filepath.Join(t.TempDir(), keyType+".pem")
+	require.Nil(t, os.WriteFile(pathname, pem.EncodeToMemory(block), 0600))
+
+	var record string
+	switch public := public.(type) {
+	case *rsa.PublicKey:
+		der, err := x509.MarshalPKIXPublicKey(public)
+		require.Nil(t, err)
+		record = "v=DKIM1; k=rsa; p=" + base64.StdEncoding.EncodeToString(der)
+	case ed25519.PublicKey:
+		record = "v=DKIM1; k=ed25519; p=" + base64.StdEncoding.EncodeToString(public)
+	}
+	return pathname, record
+}
+
+func verifyDKIM(t *testing.T, data []byte, name, record string) []*dkim.Verification {
+	verifications, err := dkim.VerifyWithOptions(bytes.NewReader(data), &dkim.VerifyOptions{
+		LookupTXT: func(domain string) ([]string, error) {
+			if domain != name {
+				return nil, fmt.Errorf("unexpected lookup: %s", domain)
+			}
+			return []string{record}, nil
+		},
+	})
+	require.Nil(t, err)
+	return verifications
+}
+
+func TestDKIMSignBounce(t *testing.T) {
+	for _, keyType := range []string{"rsa", "ed25519"} {
+		t.Run(keyType, func(t *testing.T) {
+			api, transport := newTestClient(t)
+			keyFile, record := writeDKIMKey(t, keyType)
+			viper.Set("domains", map[string]any{api.domain: map[string]any{
+				"dkim_selector": "bounce",
+				"dkim_domain":   "bounces.example.net",
+				"dkim_key":      keyFile,
+			}})
+			defer viper.Set("domains", nil)
+
+			require.Nil(t, api.storeEvent(failedVariant(t, "signed", "permanent")))
+			require.Nil(t, api.SendBounces())
+			require.Len(t, transport.messages, 1)
+			data := transport.messages[0].Data
+
+			verifications := verifyDKIM(t, data, "bounce._domainkey.bounces.example.net", record)
+			require.Len(t, verifications, 1)
+			require.Nil(t, verifications[0].Err)
+			require.Equal(t, "bounces.example.net", verifications[0].Domain)
+			require.Contains(t, verifications[0].HeaderKeys, "From")
+
+			// a modified body no longer verifies
+			tampered := bytes.Replace(data, []byte("MAILER-DAEMON, please"), []byte("MAILER-DAEMON, kindly"), 1)
+			require.NotEqual(t, data, tampered)
+			verifications = verifyDKIM(t, tampered, "bounce._domainkey.bounces.example.net", record)
+			require.Len(t, verifications, 1)
+			require.NotNil(t, verifications[0].Err)
+
+			// a key for another selector does not verify
+			_, other := writeDKIMKey(t, keyType)
+			verifications = verifyDKIM(t, data, "bounce._domainkey.bounces.example.net", other)
+			require.Len(t, verifications, 1)
+			require.NotNil(t, verifications[0].Err)
+		})
+	}
+}
+
+func TestDKIMUnsigned(t *testing.T) {
+	api, transport := newTestClient(t)
+	require.Nil(t, api.storeEvent(failedVariant(t, "unsigned", "permanent")))
+	require.Nil(t, api.SendBounces())
+	require.Len(t, transport.messages, 1)
+	require.NotContains(t, string(transport.messages[0].Data), "DKIM-Signature")
+}
+
+func TestDKIMConfigErrors(t *testing.T) {
+	api, _ := newTestClient(t)
+	defer viper.Set("domains", nil)
+
+	viper.Set("domains", map[string]any{api.domain: map[string]any{"dkim_key": "/nonexistent"}})
+	_, err := DKIMOptions(api.domain)
+	require.ErrorContains(t, err, "dkim_selector")
+
+	viper.Set("domains", map[string]any{api.domain: map[string]any{"dkim_key": "/nonexistent", "dkim_selector": "s"}})
+	_, err = DKIMOptions(api.domain)
+	require.NotNil(t, err)
+
+	pathname := filepath.Join(t.TempDir(), "bad.pem")
+	require.Nil(t, os.WriteFile(pathname, []byte("not a key"), 0600))
+	viper.Set("domains", map[string]any{api.domain: map[string]any{"dkim_key": pathname, "dkim_selector": "s"}})
+	_, err = DKIMOptions(api.domain)
+	require.ErrorContains(t, err, "no PEM data")
+
+	keyFile, _ := writeDKIMKey(t, "ed25519")
+	viper.Set("domains", map[string]any{api.domain: map[string]any{"dkim_key": keyFile, "dkim_selector": "s"}})
+	options, err := DKIMOptions(api.domain)
+	require.Nil(t, err)
+	require.Equal(t, api.domain, options.Domain)
+}
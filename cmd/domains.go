@@ -31,10 +31,9 @@ POSSIBILITY OF SUCH DAMAGE.
 package cmd
 
 import (
-	"fmt"
+	"os"
 
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 )
 
 var domainsCmd = &cobra.Command{
@@ -47,13 +46,13 @@ Output a list of all domains found in the config file.
 		api := NewClient()
 		domains, err := api.Domains()
 		cobra.CheckErr(err)
-		if viper.GetBool("json") {
-			fmt.Println(FormatJSON(&domains))
-		} else {
-			for _, domain := range domains {
-				fmt.Println(domain)
-			}
+		format := OutputFormat(OutputText)
+		output, err := NewOutput(os.Stdout, format, []string{"domain"}, format == OutputText || format == OutputTable)
+		cobra.CheckErr(err)
+		for _, domain := range domains {
+			cobra.CheckErr(output.Write(domain, map[string]string{"domain": domain}))
 		}
+		cobra.CheckErr(output.Close())
 	},
 }
 
@@ -31,27 +31,175 @@ POSSIBILITY OF SUCH DAMAGE.
 package cmd
 
 import (
+	"context"
 	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/mailgun/mailgun-go/v5/events"
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 )
 
+var eventsBegin string
+var eventsEnd string
+var eventsLocal bool
+var eventsColumns string
+var eventsNoHeader bool
+var eventsFollow bool
+var eventsProcess bool
+var eventsFilter EventFilter
+
 var eventsCmd = &cobra.Command{
 	Use:   "events",
 	Short: "query mailgun events",
 	Long: `
 Output mailgun events for selected domain.
+
+The filter flags map onto the mailgun events API query.  With --local the
+same filters are applied to the events already in the local events store
+instead of querying the API.
+
+--begin and --end accept an absolute time (RFC3339, RFC1123Z, YYYY-MM-DD,
+YYYY-MM-DD HH:MM or a unix timestamp), "now", or a time before now such as
+30m, 2h, 3d or 1w.  Results are newest first unless --ascending is set.
+
+By default the events are written as a table; --columns selects from
+timestamp, event, recipient, sender, subject, status and id for table and
+csv output.  Table columns are truncated to fit the terminal width.
+
+With --follow new events are polled from the API and written as they
+arrive, starting now unless --begin is set, until interrupted or --limit
+events are written.  Followed events are stored, but they are forwarded to
+the event sinks and bounces are sent for them only with --process.  Use a table, ndjson, csv or template output
+format with --follow.
 `,
+	Args: cobra.NoArgs,
 	Run: func(cmd *cobra.Command, args []string) {
+		filter, err := eventsQueryFilter(time.Now())
+		cobra.CheckErr(err)
+		columns, err := SelectColumns(eventsColumns, eventColumns, eventColumns)
+		cobra.CheckErr(err)
 		api := NewClient()
-		events, err := api.QueryEvents()
+		output, err := NewOutput(os.Stdout, OutputFormat(OutputText), columns, eventsNoHeader)
 		cobra.CheckErr(err)
-		if viper.GetBool("json") {
-			fmt.Println(FormatJSON(&events))
+		if eventsFollow {
+			cobra.CheckErr(followEvents(api, filter, output))
+			return
 		}
+		var events *[]events.Event
+		if eventsLocal {
+			events, err = api.LocalEvents(filter)
+		} else {
+			events, err = api.FilterEvents(filter)
+		}
+		cobra.CheckErr(err)
+		for _, event := range *events {
+			row, err := eventRow(event)
+			cobra.CheckErr(err)
+			cobra.CheckErr(output.Write(event, row))
+		}
+		cobra.CheckErr(output.Close())
 	},
 }
 
+// followEvents writes events to output as they arrive until interrupted
+func followEvents(api *Client, filter *EventFilter, output *Output) error {
+	if eventsLocal {
+		return fmt.Errorf("--follow cannot be used with --local")
+	}
+	if !filter.End.IsZero() {
+		return fmt.Errorf("--follow cannot be used with --end")
+	}
+	if !output.Streaming() {
+		return fmt.Errorf("--follow requires a table, ndjson, csv or template output format")
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	err := api.FollowEvents(ctx, filter, eventsProcess, func(batch []events.Event) error {
+		for _, event := range batch {
+			row, err := eventRow(event)
+			if err != nil {
+				return err
+			}
+			err = output.Write(event, row)
+			if err != nil {
+				return err
+			}
+		}
+		return output.Flush()
+	})
+	if err != nil {
+		return err
+	}
+	return output.Close()
+}
+
+// eventsQueryFilter returns the filter selected by the command flags
+func eventsQueryFilter(now time.Time) (*EventFilter, error) {
+	filter := eventsFilter
+	var err error
+	filter.Begin, err = ParseEventTime(eventsBegin, now)
+	if err != nil {
+		return nil, fmt.Errorf("begin: %v", err)
+	}
+	filter.End, err = ParseEventTime(eventsEnd, now)
+	if err != nil {
+		return nil, fmt.Errorf("end: %v", err)
+	}
+	if !filter.Begin.IsZero() && !filter.End.IsZero() && filter.End.Before(filter.Begin) {
+		return nil, fmt.Errorf("end %s is before begin %s", filter.End.Format(time.RFC3339), filter.Begin.Format(time.RFC3339))
+	}
+	if filter.Limit < 0 {
+		return nil, fmt.Errorf("invalid limit: %d", filter.Limit)
+	}
+	return &filter, nil
+}
+
+var eventColumns = []string{"timestamp", "event", "recipient", "sender", "subject", "status", "id"}
+
+// eventRow returns the table column values for an event
+func eventRow(event events.Event) (map[string]string, error) {
+	fields, err := fieldsOf(event)
+	if err != nil {
+		return nil, err
+	}
+	sender := fields.Envelope.Sender
+	if sender == "" {
+		sender = fields.Message.Headers.From
+	}
+	status := ""
+	if fields.DeliveryStatus.Code != 0 {
+		status = strconv.Itoa(fields.DeliveryStatus.Code)
+	}
+	return map[string]string{
+		"timestamp": event.GetTimestamp().Format(time.RFC3339),
+		"event":     event.GetName(),
+		"recipient": fields.Recipient,
+		"sender":    sender,
+		"subject":   fields.Message.Headers.Subject,
+		"status":    status,
+		"id":        event.GetID(),
+	}, nil
+}
+
 func init() {
 	rootCmd.AddCommand(eventsCmd)
+	eventsCmd.Flags().StringVarP(&eventsBegin, "begin", "b", "", "earliest event time")
+	eventsCmd.Flags().StringVarP(&eventsEnd, "end", "e", "", "latest event time")
+	eventsCmd.Flags().StringVarP(&eventsFilter.Event, "event", "E", "", "event type")
+	eventsCmd.Flags().StringVarP(&eventsFilter.Recipient, "recipient", "r", "", "recipient address")
+	eventsCmd.Flags().StringVarP(&eventsFilter.From, "from", "f", "", "From header address")
+	eventsCmd.Flags().StringVarP(&eventsFilter.Tag, "tag", "t", "", "message tag")
+	eventsCmd.Flags().StringVarP(&eventsFilter.Severity, "severity", "s", "", "failure severity (temporary or permanent)")
+	eventsCmd.Flags().StringVarP(&eventsFilter.MessageID, "message-id", "m", "", "original Message-Id")
+	eventsCmd.Flags().IntVarP(&eventsFilter.Limit, "limit", "n", 0, "maximum number of events")
+	eventsCmd.Flags().BoolVarP(&eventsFilter.Ascending, "ascending", "a", false, "oldest events first")
+	eventsCmd.Flags().BoolVar(&eventsLocal, "local", false, "filter the local events store")
+	eventsCmd.Flags().StringVarP(&eventsColumns, "columns", "C", "", "comma separated table columns")
+	eventsCmd.Flags().BoolVar(&eventsNoHeader, "no-header", false, "omit the table header")
+	eventsCmd.Flags().BoolVarP(&eventsFollow, "follow", "F", false, "write new events as they arrive")
+	eventsCmd.Flags().BoolVar(&eventsProcess, "process", false, "forward followed events to the event sinks and send their bounces")
 }
@@ -0,0 +1,236 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mailgun/mailgun-go/v5"
+	"github.com/mailgun/mailgun-go/v5/events"
+)
+
+// mailgun returns at most this many events per page
+const maxEventPageSize = 300
+
+// EventFilter selects events by time range and field values, either as
+// mailgun API query parameters or applied to locally stored events
+type EventFilter struct {
+	Begin     time.Time
+	End       time.Time
+	Event     string
+	Recipient string
+	From      string
+	Tag       string
+	Severity  string
+	MessageID string
+	Limit     int
+	Ascending bool
+}
+
+var relativeTimePattern = regexp.MustCompile(`^(\d+)([dw])$`)
+
+var eventTimeLayouts = []string{
+	time.RFC3339,
+	time.RFC1123Z,
+	time.RFC1123,
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// ParseEventTime parses an absolute time, a unix timestamp, "now", or a
+// duration before now such as 90m, 2h, 3d or 1w
+func ParseEventTime(value string, now time.Time) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if value == "now" {
+		return now, nil
+	}
+	if match := relativeTimePattern.FindStringSubmatch(value); match != nil {
+		count, err := strconv.Atoi(match[1])
+		if err != nil {
+			return time.Time{}, err
+		}
+		days := count
+		if match[2] == "w" {
+			days *= 7
+		}
+		return now.AddDate(0, 0, -days), nil
+	}
+	duration, err := time.ParseDuration(value)
+	if err == nil {
+		return now.Add(-duration), nil
+	}
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err == nil {
+		return time.Unix(seconds, 0).UTC(), nil
+	}
+	for _, layout := range eventTimeLayouts {
+		timestamp, err := time.ParseInLocation(layout, value, time.Local)
+		if err == nil {
+			return timestamp, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time: %s", value)
+}
+
+// ListOptions returns the mailgun API query for the filter
+func (f *EventFilter) ListOptions() *mailgun.ListEventOptions {
+	options := mailgun.ListEventOptions{
+		Begin:          f.Begin,
+		End:            f.End,
+		ForceAscending: f.Ascending,
+		Filter:         map[string]string{},
+	}
+	if f.Limit > 0 {
+		options.Limit = min(f.Limit, maxEventPageSize)
+	}
+	for key, value := range map[string]string{
+		"event":      f.Event,
+		"recipient":  f.Recipient,
+		"from":       f.From,
+		"tags":       f.Tag,
+		"severity":   f.Severity,
+		"message-id": f.MessageID,
+	} {
+		if value != "" {
+			options.Filter[key] = value
+		}
+	}
+	return &options
+}
+
+// eventFields holds the fields common to the event types used for filtering
+// and display
+type eventFields struct {
+	Recipient string   `json:"recipient"`
+	Severity  string   `json:"severity"`
+	Reason    string   `json:"reason"`
+	URL       string   `json:"url"`
+	Tags      []string `json:"tags"`
+	Envelope  struct {
+		Sender string `json:"sender"`
+	} `json:"envelope"`
+	Message struct {
+		Headers struct {
+			From      string `json:"from"`
+			Subject   string `json:"subject"`
+			MessageID string `json:"message-id"`
+		} `json:"headers"`
+	} `json:"message"`
+	DeliveryStatus struct {
+		Code        int    `json:"code"`
+		Message     string `json:"message"`
+		Description string `json:"description"`
+	} `json:"delivery-status"`
+}
+
+func fieldsOf(event events.Event) (*eventFields, error) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return nil, err
+	}
+	var fields eventFields
+	err = json.Unmarshal(data, &fields)
+	if err != nil {
+		return nil, err
+	}
+	return &fields, nil
+}
+
+// matchAny reports whether value equals any of the alternatives in a filter
+// expression of the form "a OR b"
+func matchAny(expression, value string) bool {
+	for _, alternative := range strings.Split(expression, " OR ") {
+		if strings.EqualFold(strings.TrimSpace(alternative), value) {
+			return true
+		}
+	}
+	return false
+}
+
+// Match reports whether a stored event passes the filter
+func (f *EventFilter) Match(event events.Event) (bool, error) {
+	timestamp := event.GetTimestamp()
+	if !f.Begin.IsZero() && timestamp.Before(f.Begin) {
+		return false, nil
+	}
+	if !f.End.IsZero() && timestamp.After(f.End) {
+		return false, nil
+	}
+	if f.Event != "" && !matchAny(f.Event, event.GetName()) {
+		return false, nil
+	}
+	fields, err := fieldsOf(event)
+	if err != nil {
+		return false, err
+	}
+	if f.Recipient != "" && !matchAny(f.Recipient, fields.Recipient) {
+		return false, nil
+	}
+	if f.Severity != "" && !matchAny(f.Severity, fields.Severity) {
+		return false, nil
+	}
+	if f.MessageID != "" && !matchAny(strings.Trim(f.MessageID, "<>"), strings.Trim(fields.Message.Headers.MessageID, "<>")) {
+		return false, nil
+	}
+	if f.From != "" {
+		from := strings.ToLower(fields.Message.Headers.From + " " + fields.Envelope.Sender)
+		if !strings.Contains(from, strings.ToLower(f.From)) {
+			return false, nil
+		}
+	}
+	if f.Tag != "" {
+		found := false
+		for _, tag := range fields.Tags {
+			if matchAny(f.Tag, tag) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// LocalEvents returns the events in the events store that pass the filter,
+// newest first unless the filter is ascending
+func (c *Client) LocalEvents(filter *EventFilter) (*[]events.Event, error) {
+	keys, err := c.edb.Keys()
+	if err != nil {
+		return nil, err
+	}
+	selected := []events.Event{}
+	for _, key := range keys {
+		event, err := c.loadEvent(key)
+		if err != nil {
+			return nil, err
+		}
+		ok, err := filter.Match(event)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			selected = append(selected, event)
+		}
+	}
+	sort.SliceStable(selected, func(i, j int) bool {
+		if filter.Ascending {
+			return selected[i].GetTimestamp().Before(selected[j].GetTimestamp())
+		}
+		return selected[i].GetTimestamp().After(selected[j].GetTimestamp())
+	})
+	if filter.Limit > 0 && len(selected) > filter.Limit {
+		selected = selected[:filter.Limit]
+	}
+	return &selected, nil
+}
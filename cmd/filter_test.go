@@ -0,0 +1,197 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mailgun/mailgun-go/v5/events"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseEventTime(t *testing.T) {
+	now := time.Date(2025, 10, 16, 12, 0, 0, 0, time.UTC)
+	for value, expected := range map[string]time.Time{
+		"":                                {},
+		"now":                             now,
+		"2h":                              now.Add(-2 * time.Hour),
+		"90m":                             now.Add(-90 * time.Minute),
+		"3d":                              now.AddDate(0, 0, -3),
+		"1w":                              now.AddDate(0, 0, -7),
+		"2025-10-01T08:30:00Z":            time.Date(2025, 10, 1, 8, 30, 0, 0, time.UTC),
+		"1760616000":                      time.Unix(1760616000, 0).UTC(),
+		"2025-10-01":                      time.Date(2025, 10, 1, 0, 0, 0, 0, time.Local),
+		"Thu, 16 Oct 2025 13:00:00 +0000": time.Date(2025, 10, 16, 13, 0, 0, 0, time.UTC),
+	} {
+		actual, err := ParseEventTime(value, now)
+		require.Nil(t, err, value)
+		require.True(t, expected.Equal(actual), "%s: %v", value, actual)
+	}
+	_, err := ParseEventTime("yesterday", now)
+	require.NotNil(t, err)
+}
+
+func TestEventFilterOptions(t *testing.T) {
+	begin := time.Date(2025, 10, 16, 0, 0, 0, 0, time.UTC)
+	filter := EventFilter{
+		Begin:     begin,
+		Event:     "failed",
+		Recipient: "nobody@example.org",
+		Tag:       "newsletter",
+		Severity:  "permanent",
+		Limit:     1000,
+		Ascending: true,
+	}
+	options := filter.ListOptions()
+	require.Equal(t, begin, options.Begin)
+	require.True(t, options.End.IsZero())
+	require.True(t, options.ForceAscending)
+	require.Equal(t, maxEventPageSize, options.Limit)
+	require.Equal(t, map[string]string{
+		"event":     "failed",
+		"recipient": "nobody@example.org",
+		"tags":      "newsletter",
+		"severity":  "permanent",
+	}, options.Filter)
+}
+
+func TestEventFilterMatch(t *testing.T) {
+	failed := loadTestEvent(t, "failed.json")
+	for _, filter := range []EventFilter{
+		{},
+		{Event: "failed"},
+		{Event: "delivered OR failed"},
+		{Recipient: "Nobody@example.org"},
+		{From: "alice@example.com"},
+		{Tag: "newsletter"},
+		{Severity: "permanent"},
+		{MessageID: "<20251016120000.1.ABCDEF@example.com>"},
+		{Begin: failed.GetTimestamp().Add(-time.Minute), End: failed.GetTimestamp().Add(time.Minute)},
+	} {
+		ok, err := filter.Match(failed)
+		require.Nil(t, err)
+		require.True(t, ok, "%+v", filter)
+	}
+	for _, filter := range []EventFilter{
+		{Event: "delivered"},
+		{Recipient: "somebody@example.org"},
+		{From: "bob@example.com"},
+		{Tag: "receipt"},
+		{Severity: "temporary"},
+		{MessageID: "other@example.com"},
+		{Begin: failed.GetTimestamp().Add(time.Minute)},
+		{End: failed.GetTimestamp().Add(-time.Minute)},
+	} {
+		ok, err := filter.Match(failed)
+		require.Nil(t, err)
+		require.False(t, ok, "%+v", filter)
+	}
+}
+
+func TestLocalEvents(t *testing.T) {
+	api, _ := newTestClient(t)
+	timestamp := loadTestEvent(t, "failed.json").GetTimestamp()
+	for i, id := range []string{"first", "second", "third"} {
+		failed := failedVariant(t, id, "permanent")
+		failed.Timestamp = float64(timestamp.Add(time.Duration(i)*time.Hour).UnixMicro()) / 1e6
+		require.Nil(t, api.storeEvent(failed))
+	}
+	require.Nil(t, api.storeEvent(failedVariant(t, "delayed", "temporary")))
+	require.Nil(t, api.storeEvent(loadTestEvent(t, "complained.json")))
+
+	ids := func(filter *EventFilter) []string {
+		found, err := api.LocalEvents(filter)
+		require.Nil(t, err)
+		ids := []string{}
+		for _, event := range *found {
+			ids = append(ids, event.GetID())
+		}
+		return ids
+	}
+	require.Equal(t, []string{"third", "second", "first"}, ids(&EventFilter{Severity: "permanent"}))
+	require.Equal(t, []string{"first", "second"}, ids(&EventFilter{Severity: "permanent", Ascending: true, Limit: 2}))
+	require.Equal(t, []string{"delayed"}, ids(&EventFilter{Event: "failed", Severity: "temporary"}))
+	require.Equal(t, []string{"ncV2XwymRUKbPek_MIM-Gw"}, ids(&EventFilter{Event: "complained"}))
+	require.Equal(t, []string{"third", "second"}, ids(&EventFilter{Event: "failed", Begin: timestamp.Add(30 * time.Minute)}))
+}
+
+// startEventsServer serves the events endpoint, returning each fixture once
+// and then empty pages
+func startEventsServer(t *testing.T, names ...string) (*httptest.Server, chan string) {
+	items := []json.RawMessage{}
+	for _, name := range names {
+		data, err := os.ReadFile("testdata/events/" + name)
+		require.Nil(t, err)
+		items = append(items, data)
+	}
+	queries := make(chan string, 100)
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries <- r.URL.RawQuery
+		page := []json.RawMessage{}
+		if r.URL.Path == "/v3/example.com/events" {
+			page = items
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"items":  page,
+			"paging": map[string]string{"next": server.URL + "/v3/example.com/events/next"},
+		})
+	}))
+	t.Cleanup(server.Close)
+	return server, queries
+}
+
+func TestFilterEventsError(t *testing.T) {
+	api, _ := newTestClient(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"message": "Invalid event type"}`, http.StatusBadRequest)
+	}))
+	t.Cleanup(server.Close)
+	require.Nil(t, api.api.SetAPIBase(server.URL))
+	_, err := api.FilterEvents(&EventFilter{Event: "bogus"})
+	require.ErrorContains(t, err, "400")
+}
+
+func TestFollowEvents(t *testing.T) {
+	api, transport := newTestClient(t)
+	api.domain = "example.com"
+	server, queries := startEventsServer(t, "failed.json", "complained.json")
+	require.Nil(t, api.api.SetAPIBase(server.URL))
+	record := filepath.Join(t.TempDir(), "published")
+	api.sinks = loadTestSinks(t, map[string]any{"type": "exec", "command": []string{"sh", "-c", "echo $MAILGUN_EVENT_ID >> " + record}})
+
+	followed := []string{}
+	output := func(batch []events.Event) error {
+		for _, event := range batch {
+			followed = append(followed, event.GetID())
+		}
+		return nil
+	}
+	err := api.FollowEvents(context.Background(), &EventFilter{Severity: "permanent", Limit: 1}, false, output)
+	require.Nil(t, err)
+	require.Equal(t, []string{"W3X4JOhFT-OZidZGKKr9iA"}, followed)
+	require.Contains(t, <-queries, "severity=permanent")
+	require.True(t, api.edb.Has("W3X4JOhFT-OZidZGKKr9iA"))
+	require.False(t, api.edb.Has("ncV2XwymRUKbPek_MIM-Gw"))
+	require.Empty(t, transport.messages)
+
+	// without a limit events are followed until the context is cancelled
+	followed = []string{}
+	ctx, cancel := context.WithCancel(context.Background())
+	err = api.FollowEvents(ctx, &EventFilter{}, false, func(batch []events.Event) error {
+		cancel()
+		return output(batch)
+	})
+	require.Nil(t, err)
+	require.Equal(t, []string{"W3X4JOhFT-OZidZGKKr9iA", "ncV2XwymRUKbPek_MIM-Gw"}, followed)
+	require.Empty(t, transport.messages)
+
+	// followed events are not forwarded to the event sinks
+	require.NoFileExists(t, record)
+}
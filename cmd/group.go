@@ -0,0 +1,143 @@
+package cmd
+
+import (
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mailgun/mailgun-go/v5/events"
+	"github.com/spf13/viper"
+)
+
+// bounceItem is one failed event reported in a DSN with its action
+type bounceItem struct {
+	key    string
+	event  *events.Failed
+	action string
+}
+
+// groupKey identifies the failures reported together in one DSN: those of
+// the same original message and envelope sender
+func groupKey(key string, failed *events.Failed) string {
+	messageID := strings.Trim(failed.Message.Headers.MessageID, "<>")
+	if messageID == "" {
+		return "event " + key
+	}
+	return messageID + " " + strings.ToLower(strings.Trim(failed.Envelope.Sender, "<>"))
+}
+
+// groupFailures returns the failures grouped by original message and sender
+// in order of each group's first failure, holding back any group whose first
+// failure is more recent than the collection window
+func groupFailures(failures []failedEvent, window time.Duration) [][]failedEvent {
+	sorted := append([]failedEvent{}, failures...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].event.Timestamp < sorted[j].event.Timestamp
+	})
+	order := []string{}
+	groups := map[string][]failedEvent{}
+	for _, failure := range sorted {
+		gkey := groupKey(failure.key, failure.event)
+		if _, ok := groups[gkey]; !ok {
+			order = append(order, gkey)
+		}
+		groups[gkey] = append(groups[gkey], failure)
+	}
+	ret := [][]failedEvent{}
+	for _, gkey := range order {
+		group := groups[gkey]
+		if time.Since(group[0].event.GetTimestamp()) < window {
+			if viper.GetBool("verbose") {
+				log.Printf("collecting_bounce: %s recipients=%d\n", group[0].key, len(group))
+			}
+			continue
+		}
+		ret = append(ret, group)
+	}
+	return ret
+}
+
+// handleGroup sends a single DSN covering every failure in the group that
+// is due one, and writes a record for each event of the group to the
+// bounced store
+func (c *Client) handleGroup(group []failedEvent, delivered map[string]bool, accepted map[string]time.Time) error {
+	records := map[string]*BounceRecord{}
+	items := []bounceItem{}
+	index := map[string]int{}
+	for _, failure := range group {
+		records[failure.key] = &BounceRecord{}
+		action, err := c.failureAction(failure.key, failure.event, delivered)
+		if err != nil {
+			return err
+		}
+		if action == "" {
+			continue
+		}
+		item := bounceItem{failure.key, failure.event, action}
+		dkey := deliveryKey(failure.event.Message.Headers.MessageID, failure.event.Recipient)
+		i, ok := index[dkey]
+		if !ok {
+			index[dkey] = len(items)
+			items = append(items, item)
+		} else if action == "failed" && items[i].action == "delayed" {
+			// a permanent failure supersedes an unsent delayed warning
+			items[i] = item
+		}
+	}
+
+	if len(items) > 0 {
+		bounced, err := c.deliverBounce(items, accepted)
+		if err != nil {
+			return err
+		}
+		keys := []string{}
+		if len(items) > 1 {
+			for _, item := range items {
+				keys = append(keys, item.key)
+			}
+		}
+		for _, item := range items {
+			record := *bounced
+			if record.Suppressed == "" {
+				record.Action = item.action
+			}
+			if len(keys) > 0 {
+				record.Group = keys
+			}
+			records[item.key] = &record
+			err := c.recordDelayed(item, bounced)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	now := time.Now()
+	for _, failure := range group {
+		record := records[failure.key]
+		record.Timestamp = now
+		record.Sender = failure.event.Envelope.Sender
+		record.Recipient = failure.event.Recipient
+		record.Category = c.classifier.Classify(failure.event)
+		if record.Action != "" && record.Suppressed == "" {
+			record.Status = dsnStatus(failure.event)
+		}
+		err := c.bdb.SetObject(failure.key, record)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// groupAction is the action reported in the subject and text of a DSN:
+// failed if any recipient failed, otherwise delayed
+func groupAction(items []bounceItem) string {
+	for _, item := range items {
+		if item.action == "failed" {
+			return "failed"
+		}
+	}
+	return "delayed"
+}
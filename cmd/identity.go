@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/emersion/go-message/mail"
+	"github.com/spf13/viper"
+)
+
+// BounceIdentity is the name and addresses bounces for a domain are sent
+// under
+type BounceIdentity struct {
+	FromName       string `json:"from_name"`
+	FromAddress    string `json:"from_address"`
+	ReportingMTA   string `json:"reporting_mta"`
+	EnvelopeSender string `json:"envelope_sender"`
+}
+
+// LoadBounceIdentity reads the bounce_from_name, bounce_from_address,
+// reporting_mta and bounce_envelope_sender keys for a domain.  The
+// Reporting-MTA defaults to the local hostname, the From address to
+// MAILER-DAEMON at the Reporting-MTA and the envelope sender to the default
+// of the bounce transport; an envelope sender of <> selects the null
+// reverse-path.
+func LoadBounceIdentity(domain string) (*BounceIdentity, error) {
+	identity := BounceIdentity{
+		FromName:       DomainString(domain, "bounce_from_name"),
+		FromAddress:    DomainString(domain, "bounce_from_address"),
+		ReportingMTA:   DomainString(domain, "reporting_mta"),
+		EnvelopeSender: DomainString(domain, "bounce_envelope_sender"),
+	}
+	if identity.ReportingMTA == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, err
+		}
+		identity.ReportingMTA = hostname
+	}
+	if !validHostname(identity.ReportingMTA) {
+		return nil, fmt.Errorf("%s: invalid reporting_mta: %q", domain, identity.ReportingMTA)
+	}
+	if identity.FromName == "" {
+		identity.FromName = "Mailer Daemon"
+	}
+	if identity.FromAddress == "" {
+		identity.FromAddress = "MAILER-DAEMON@" + identity.ReportingMTA
+	}
+	if !validAddress(identity.FromAddress) {
+		return nil, fmt.Errorf("%s: invalid bounce_from_address: %q", domain, identity.FromAddress)
+	}
+	if identity.EnvelopeSender != "" && identity.EnvelopeSender != "<>" && !validAddress(identity.EnvelopeSender) {
+		return nil, fmt.Errorf("%s: invalid bounce_envelope_sender: %q", domain, identity.EnvelopeSender)
+	}
+	return &identity, nil
+}
+
+// ValidateBounceIdentities checks the bounce identity of the default domain
+// and of every domain with its own configuration
+func ValidateBounceIdentities() error {
+	domains := []string{viper.GetString("domain")}
+	for domain := range viper.GetStringMap("domains") {
+		domains = append(domains, domain)
+	}
+	for _, domain := range domains {
+		_, err := LoadBounceIdentity(domain)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validAddress accepts a bare addr-spec with a domain part
+func validAddress(address string) bool {
+	parsed, err := mail.ParseAddress(address)
+	if err != nil || parsed.Name != "" || parsed.Address != address {
+		return false
+	}
+	_, domain, ok := strings.Cut(address, "@")
+	return ok && validHostname(domain)
+}
+
+// validHostname accepts a DNS name of letters, digits and hyphens
+func validHostname(name string) bool {
+	name = strings.TrimSuffix(name, ".")
+	if name == "" || len(name) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(name, ".") {
+		if label == "" || len(label) > 63 || strings.HasPrefix(label, "-") || strings.HasSuffix(label, "-") {
+			return false
+		}
+		for _, r := range label {
+			if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-') {
+				return false
+			}
+		}
+	}
+	return true
+}
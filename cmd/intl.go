@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/idna"
+)
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// asciiHostname returns the A-label form of a domain name, or the name
+// unchanged if it cannot be converted
+func asciiHostname(name string) string {
+	if isASCII(name) {
+		return name
+	}
+	ascii, err := idna.Lookup.ToASCII(name)
+	if err != nil {
+		return name
+	}
+	return ascii
+}
+
+// normalizeAddress prepares an address for the envelope and the To header:
+// when the local part is ASCII an IDN domain is converted to its A-label so
+// that no SMTPUTF8 support is needed; an address with a UTF-8 local part can
+// only be used as UTF-8, so its domain is converted to the U-label
+func normalizeAddress(address string) string {
+	address = strings.TrimSpace(strings.Trim(address, "<>"))
+	local, domain, ok := strings.Cut(address, "@")
+	if !ok {
+		return address
+	}
+	if isASCII(local) {
+		return local + "@" + asciiHostname(domain)
+	}
+	unicode, err := idna.Lookup.ToUnicode(domain)
+	if err != nil {
+		return address
+	}
+	return local + "@" + unicode
+}
+
+// dsnAddress formats an address for a delivery-status recipient field: the
+// rfc822 address type when the address can be expressed in ASCII, otherwise
+// the RFC 6533 utf-8 address type with the address as utf-8-addr-xtext
+func dsnAddress(address string) string {
+	address = normalizeAddress(address)
+	if isASCII(address) {
+		return "rfc822; " + address
+	}
+	return "utf-8; " + utf8AddrXtext(address)
+}
+
+// utf8AddrXtext encodes an address as RFC 6533 utf-8-addr-xtext, replacing
+// non-ASCII characters, controls, space, "+", "=" and "\" with \x{HEX}
+func utf8AddrXtext(address string) string {
+	var b strings.Builder
+	for _, r := range address {
+		if r > 0x20 && r < 0x7f && r != '+' && r != '=' && r != '\\' {
+			b.WriteRune(r)
+			continue
+		}
+		fmt.Fprintf(&b, "\\x{%X}", r)
+	}
+	return b.String()
+}
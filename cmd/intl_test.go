@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/emersion/go-message"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeAddress(t *testing.T) {
+	cases := map[string]string{
+		"alice@example.com":          "alice@example.com",
+		"<alice@example.com>":        "alice@example.com",
+		"bob@bücher.example":         "bob@xn--bcher-kva.example",
+		"jörg@bücher.example":        "jörg@bücher.example",
+		"jörg@xn--bcher-kva.example": "jörg@bücher.example",
+		"用户@例子.广告":                   "用户@例子.广告",
+	}
+	for address, expected := range cases {
+		require.Equal(t, expected, normalizeAddress(address), address)
+	}
+}
+
+func TestDSNAddress(t *testing.T) {
+	cases := map[string]string{
+		"nobody@example.org":    "rfc822; nobody@example.org",
+		"bob@bücher.example":    "rfc822; bob@xn--bcher-kva.example",
+		"jörg@bücher.example":   `utf-8; j\x{F6}rg@b\x{FC}cher.example`,
+		"用户@例子.广告":              `utf-8; \x{7528}\x{6237}@\x{4F8B}\x{5B50}.\x{5E7F}\x{544A}`,
+		"jörg+tag=1@example.de": `utf-8; j\x{F6}rg\x{2B}tag\x{3D}1@example.de`,
+		"jörg\tx@example.de":    `utf-8; j\x{F6}rg\x{9}x@example.de`,
+	}
+	for address, expected := range cases {
+		require.Equal(t, expected, dsnAddress(address), address)
+	}
+}
+
+func TestInternationalizedBounce(t *testing.T) {
+	api, transport := newTestClient(t)
+	recipients := []string{"用户@例子.广告", "bob@bücher.example", "nobody@example.org"}
+	for _, recipient := range recipients {
+		failed := failedVariant(t, "intl "+recipient, "permanent")
+		failed.Envelope.Sender = "jörg@bücher.example"
+		failed.Recipient = recipient
+		require.Nil(t, api.storeEvent(failed))
+	}
+	require.Nil(t, api.SendBounces())
+	require.Len(t, transport.messages, 1)
+	sent := transport.messages[0]
+	require.Equal(t, []string{"jörg@bücher.example"}, sent.Recipients)
+
+	entity, err := message.Read(bytes.NewReader(sent.Data))
+	require.Nil(t, err)
+	require.Equal(t, "<jörg@bücher.example>", entity.Header.Get("To"))
+
+	parts := readBounceParts(t, bytes.NewBuffer(sent.Data))
+	status := parts["message/delivery-status"]
+	require.True(t, isASCII(status))
+	require.Contains(t, status, "Final-Recipient: utf-8; \\x{7528}\\x{6237}@\\x{4F8B}\\x{5B50}.\\x{5E7F}\\x{544A}\r\n")
+	require.Contains(t, status, "Final-Recipient: rfc822; bob@xn--bcher-kva.example\r\n")
+	require.Contains(t, status, "Final-Recipient: rfc822; nobody@example.org\r\n")
+	require.Contains(t, parts["text/plain"], "用户@例子.广告: 550")
+
+	// an ASCII local part is delivered without SMTPUTF8
+	transport.messages = nil
+	failed := failedVariant(t, "idn sender", "permanent")
+	failed.Envelope.Sender = "alice@bücher.example"
+	failed.Message.Headers.MessageID = "idn@example.com"
+	require.Nil(t, api.storeEvent(failed))
+	require.Nil(t, api.SendBounces())
+	require.Len(t, transport.messages, 1)
+	require.Equal(t, []string{"alice@xn--bcher-kva.example"}, transport.messages[0].Recipients)
+	header, _, _ := strings.Cut(string(transport.messages[0].Data), "\r\n\r\n")
+	require.Contains(t, header, "To: <alice@xn--bcher-kva.example>\r\n")
+	require.True(t, isASCII(header))
+}
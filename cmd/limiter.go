@@ -0,0 +1,152 @@
+package cmd
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// SenderLimit is the bounce rate limiter state for one sender, persisted in
+// the mailgun.limiter store
+type SenderLimit struct {
+	Sender      string            `json:"sender"`
+	WindowStart time.Time         `json:"window_start"`
+	Count       int               `json:"count"`
+	DigestStart time.Time         `json:"digest_start"`
+	Pending     []RecipientStatus `json:"pending,omitempty"`
+}
+
+func initLimiterConfig() {
+	viper.SetDefault("bounce_rate_limit", 0)
+	viper.SetDefault("bounce_rate_window", "1h")
+	viper.SetDefault("bounce_digest_interval", "1h")
+}
+
+// rateLimit counts a bounce to sender against bounce_rate_limit bounces per
+// bounce_rate_window; when the sender is over the limit the recipient
+// statuses are queued for the next digest and true is returned
+func (c *Client) rateLimit(sender string, statuses []RecipientStatus) (bool, error) {
+	limit := viper.GetInt("bounce_rate_limit")
+	if limit <= 0 {
+		return false, nil
+	}
+	key := strings.ToLower(sender)
+	state := SenderLimit{Sender: sender}
+	if c.ldb.Has(key) {
+		_, err := c.ldb.GetObject(key, &state)
+		if err != nil {
+			return false, err
+		}
+	}
+	now := time.Now()
+	if now.Sub(state.WindowStart) >= viper.GetDuration("bounce_rate_window") {
+		state.WindowStart = now
+		state.Count = 0
+	}
+	limited := state.Count >= limit
+	if limited {
+		if len(state.Pending) == 0 {
+			state.DigestStart = now
+		}
+		state.Pending = append(state.Pending, statuses...)
+	} else {
+		state.Count++
+	}
+	return limited, c.ldb.SetObject(key, &state)
+}
+
+// SendDigests sends a digest DSN to each sender whose queued over-limit
+// bounces have waited bounce_digest_interval, and removes idle limiter state
+func (c *Client) SendDigests() error {
+	keys, err := c.ldb.Keys()
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		var state SenderLimit
+		_, err := c.ldb.GetObject(key, &state)
+		if err != nil {
+			return err
+		}
+		if len(state.Pending) == 0 {
+			if time.Since(state.WindowStart) >= viper.GetDuration("bounce_rate_window") {
+				err := c.ldb.Clear(key)
+				if err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if time.Since(state.DigestStart) < viper.GetDuration("bounce_digest_interval") {
+			continue
+		}
+		var buf bytes.Buffer
+		err = c.formatDigest(state.Sender, state.Pending, &buf)
+		if err != nil {
+			return err
+		}
+		message, err := c.signBounce(buf.Bytes())
+		if err != nil {
+			return err
+		}
+		queued, err := c.deliverMessage("digest "+key, state.Sender, message)
+		if err != nil {
+			return err
+		}
+		if !viper.GetBool("quiet") && !queued {
+			log.Printf("sent_digest: %s recipients=%d\n", state.Sender, len(state.Pending))
+		}
+		state.Pending = nil
+		state.DigestStart = time.Time{}
+		err = c.ldb.SetObject(key, &state)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// formatDigest writes a delivery status notification listing every queued
+// recipient status for a sender
+func (c *Client) formatDigest(sender string, recipients []RecipientStatus, buf *bytes.Buffer) error {
+
+	identity, err := LoadBounceIdentity(c.domain)
+	if err != nil {
+		return err
+	}
+
+	digestTemplate, err := LoadBounceTemplate(c.domain, "digest")
+	if err != nil {
+		return err
+	}
+	subject, text, html, err := digestTemplate.Render(&DigestData{
+		Sender:     sender,
+		Recipients: recipients,
+		Domain:     c.domain,
+		Hostname:   identity.ReportingMTA,
+	})
+	if err != nil {
+		return err
+	}
+
+	writer, err := c.createReport(buf, identity, sender, subject, "delivery-status")
+	if err != nil {
+		return err
+	}
+
+	err = c.addHumanPart(writer, text, html)
+	if err != nil {
+		return err
+	}
+
+	// the recipients belong to different messages, so no Arrival-Date
+	err = c.addDeliveryStatusPart(writer, identity.ReportingMTA, time.Time{}, recipients)
+	if err != nil {
+		return err
+	}
+
+	return writer.Close()
+}
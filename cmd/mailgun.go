@@ -34,14 +34,11 @@ import (
 	"bytes"
 	"context"
 	"fmt"
-	"io"
 	"log"
-	"os"
-	"os/exec"
+	"strings"
 	"sync"
 	"time"
 
-	"github.com/emersion/go-message/mail"
 	"github.com/mailgun/mailgun-go/v5"
 	"github.com/mailgun/mailgun-go/v5/events"
 	"github.com/mailgun/mailgun-go/v5/mtypes"
@@ -49,32 +46,77 @@ import (
 )
 
 type Client struct {
-	domain string
-	api    *mailgun.Client
-	edb    *DB
-	bdb    *DB
-	mutex  sync.Mutex
+	domain     string
+	api        *mailgun.Client
+	edb        *DB
+	bdb        *DB
+	ddb        *DB
+	ldb        *DB
+	qdb        *DB
+	xdb        *DB
+	cdb        *DB
+	transport  Transport
+	classifier *Classifier
+	sinks      []*EventSink
+	held       map[string]*heldEvent
+	mutex      sync.Mutex
 }
 
-func NewClient() *Client {
+func initClientConfig() {
 	viper.SetDefault("api_query_timeout", 30)
+	viper.SetDefault("bounce_attach_max_size", 1048576)
+	viper.SetDefault("delay_bounce_after", "24h")
+	viper.SetDefault("suppress_sender_locals", defaultSuppressLocals)
+}
+
+func NewClient() *Client {
+	return NewDomainClient(viper.GetString("domain"), viper.GetString("data_root"))
+}
+
+// NewDomainClient returns a client for domain keeping its stores in dataRoot
+func NewDomainClient(domain, dataRoot string) *Client {
+	err := ValidateBounceIdentities()
+	if err != nil {
+		log.Fatalf("NewClient: %v", err)
+	}
+	classifier, err := NewClassifier()
+	if err != nil {
+		log.Fatalf("NewClient: %v", err)
+	}
+	sinks, err := LoadEventSinks()
+	if err != nil {
+		log.Fatalf("NewClient: %v", err)
+	}
 	client := Client{
-		domain: viper.GetString("domain"),
-		api:    mailgun.NewMailgun(viper.GetString("api_key")),
-		edb:    NewDB(viper.GetString("data_root"), "mailgun.events"),
-		bdb:    NewDB(viper.GetString("data_root"), "mailgun.bounced"),
+		domain:     domain,
+		api:        mailgun.NewMailgun(viper.GetString("api_key")),
+		edb:        NewDB(dataRoot, "mailgun.events"),
+		bdb:        NewDB(dataRoot, "mailgun.bounced"),
+		ddb:        NewDB(dataRoot, "mailgun.delayed"),
+		ldb:        NewDB(dataRoot, "mailgun.limiter"),
+		qdb:        NewDB(dataRoot, "mailgun.queue"),
+		xdb:        NewDB(dataRoot, "mailgun.deadletter"),
+		cdb:        NewDB(dataRoot, "mailgun.complaints"),
+		classifier: classifier,
+		sinks:      sinks,
+		held:       map[string]*heldEvent{},
 	}
 	return &client
 }
 
 func (c *Client) Domains() ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*time.Duration(viper.GetInt("api_query_timeout")))
+	defer cancel()
+	return c.listDomains(ctx)
+}
+
+// listDomains returns the active domains of the account
+func (c *Client) listDomains(ctx context.Context) ([]string, error) {
 	names := []string{}
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
 	domains := c.api.ListDomains(nil)
 	var page []mtypes.Domain
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*time.Duration(viper.GetInt("api_query_timeout")))
-	defer cancel()
 	for domains.Next(ctx, &page) {
 		for _, domain := range page {
 			if domain.Type != "sandbox" && !domain.IsDisabled {
@@ -82,15 +124,78 @@ func (c *Client) Domains() ([]string, error) {
 			}
 		}
 	}
+	if domains.Err() != nil {
+		return nil, domains.Err()
+	}
 	return names, nil
 }
 
+// FetchStoredMessage retrieves the raw MIME message mailgun stored for an
+// event, returning nil if the event has no storage reference
+func (c *Client) FetchStoredMessage(storage *events.Storage) ([]byte, error) {
+	url := storage.URL
+	if url == "" {
+		if storage.Key == "" {
+			return nil, nil
+		}
+		url = fmt.Sprintf("%s/v3/domains/%s/messages/%s", c.api.APIBase(), c.domain, storage.Key)
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*time.Duration(viper.GetInt("api_query_timeout")))
+	defer cancel()
+	stored, err := c.api.GetStoredMessageRaw(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(stored.BodyMime), nil
+}
+
 func (c *Client) ResetEvents() error {
 	return c.edb.Reset()
 }
 
 func (c *Client) ResetBounced() error {
-	return c.bdb.Reset()
+	err := c.bdb.Reset()
+	if err != nil {
+		return err
+	}
+	err = c.ddb.Reset()
+	if err != nil {
+		return err
+	}
+	err = c.cdb.Reset()
+	if err != nil {
+		return err
+	}
+	return c.ldb.Reset()
+}
+
+// receiveEvent publishes an event received by monitor, the webhook receiver
+// or events --follow to the event sinks and stores it; events stored by the
+// query commands are not published.  An event not accepted by a sink with the
+// fail policy is held in memory, and is stored when retryHeldEvents has
+// published it to every such sink.
+func (c *Client) receiveEvent(event events.Event) error {
+	eid := event.GetID()
+	if _, ok := c.held[eid]; ok {
+		return nil
+	}
+	if c.edb.Has(eid) {
+		return c.storeEvent(event)
+	}
+	failed, err := c.publishEvent(event, c.sinks)
+	if err != nil {
+		return err
+	}
+	if len(failed) > 0 {
+		c.held[eid] = &heldEvent{event: event, sinks: failed}
+		if !viper.GetBool("quiet") {
+			log.Printf("held_event %s %s\n", eid, event.GetName())
+		}
+		return nil
+	}
+	return c.storeEvent(event)
 }
 
 func (c *Client) storeEvent(event events.Event) error {
@@ -141,15 +246,30 @@ func (c *Client) QueryBounceAddrs() (*[]mtypes.Bounce, error) {
 }
 
 func (c *Client) QueryEvents() (*[]events.Event, error) {
+	return c.FilterEvents(nil)
+}
+
+// FilterEvents queries the mailgun API for the events selected by the filter,
+// storing each returned event
+func (c *Client) FilterEvents(filter *EventFilter) (*[]events.Event, error) {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
-	iter := c.api.ListEvents(c.domain, nil)
+	var options *mailgun.ListEventOptions
+	limit := 0
+	if filter != nil {
+		options = filter.ListOptions()
+		limit = filter.Limit
+	}
+	iter := c.api.ListEvents(c.domain, options)
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 	allEvents := []events.Event{}
 	var page []events.Event
 	for iter.Next(ctx, &page) {
 		for _, event := range page {
+			if limit > 0 && len(allEvents) >= limit {
+				return &allEvents, nil
+			}
 			allEvents = append(allEvents, event)
 			err := c.storeEvent(event)
 			if err != nil {
@@ -157,41 +277,132 @@ func (c *Client) QueryEvents() (*[]events.Event, error) {
 			}
 		}
 	}
+	if iter.Err() != nil {
+		return nil, iter.Err()
+	}
 	return &allEvents, nil
 }
 
-func (c *Client) MonitorEvents() error {
-	bounceDisabled := viper.GetBool("no_bounce")
-	options := mailgun.ListEventOptions{PollInterval: time.Second * time.Duration(viper.GetInt("poll_interval"))}
-	iter := c.api.PollEvents(c.domain, &options)
-	ctx, cancel := context.WithCancel(context.Background())
+// FollowEvents polls for the events selected by the filter, starting now when
+// it has no begin time, until ctx is cancelled or the filter limit is
+// reached.  Each batch is stored and passed to output; only when process is
+// set are its events forwarded to the event sinks and the bounce pipeline
+// run on it.
+func (c *Client) FollowEvents(ctx context.Context, filter *EventFilter, process bool, output func([]events.Event) error) error {
+	options := filter.ListOptions()
+	if options.Begin.IsZero() {
+		options.Begin = time.Now()
+	}
+	options.PollInterval = time.Second * time.Duration(viper.GetInt("poll_interval"))
+	iter := c.api.PollEvents(c.domain, options)
+	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
+	// the poller advances past each page it returns, so only the IDs of
+	// the last two batches are kept to drop events repeated across a page
+	previous := map[string]bool{}
+	count := 0
 	var newEvents []events.Event
 	for iter.Poll(ctx, &newEvents) {
+		batch := []events.Event{}
+		seen := map[string]bool{}
 		for _, event := range newEvents {
-			err := c.storeEvent(event)
-			if err != nil {
-				return err
+			id := event.GetID()
+			if seen[id] || previous[id] || (filter.Limit > 0 && count >= filter.Limit) {
+				continue
 			}
+			seen[id] = true
+			batch = append(batch, event)
+			count++
 		}
-		if !bounceDisabled {
-			err := c.SendBounces()
-			if err != nil {
-				return err
+		if len(seen) > 0 {
+			previous = seen
+		}
+		var err error
+		if process {
+			err = c.processEvents(batch, viper.GetBool("no_bounce"))
+		} else {
+			for i := 0; err == nil && i < len(batch); i++ {
+				err = c.storeEvent(batch[i])
 			}
 		}
-		_, err := c.QueryBounceAddrs()
 		if err != nil {
 			return err
 		}
-		err = c.PruneBounced()
+		err = output(batch)
 		if err != nil {
 			return err
 		}
+		if filter.Limit > 0 && count >= filter.Limit {
+			return nil
+		}
+	}
+	if ctx.Err() != nil {
+		return nil
+	}
+	if iter.Err() != nil {
+		return fmt.Errorf("event poll failed: %v", iter.Err())
+	}
+	return fmt.Errorf("event poll failed")
+}
+
+func (c *Client) MonitorEvents() error {
+	return c.monitorEvents(context.Background())
+}
+
+// monitorEvents polls for new events until ctx is cancelled
+func (c *Client) monitorEvents(ctx context.Context) error {
+	bounceDisabled := viper.GetBool("no_bounce")
+	options := mailgun.ListEventOptions{PollInterval: time.Second * time.Duration(viper.GetInt("poll_interval"))}
+	iter := c.api.PollEvents(c.domain, &options)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var newEvents []events.Event
+	for iter.Poll(ctx, &newEvents) {
+		err := c.processEvents(newEvents, bounceDisabled)
+		if err != nil {
+			return err
+		}
+	}
+	if ctx.Err() != nil {
+		return nil
+	}
+	if iter.Err() != nil {
+		return fmt.Errorf("event poll failed: %v", iter.Err())
 	}
 	return fmt.Errorf("event poll failed")
 }
 
+// processEvents stores a batch of polled events and runs the bounce pipeline
+func (c *Client) processEvents(newEvents []events.Event, bounceDisabled bool) error {
+	err := c.retryHeldEvents()
+	if err != nil {
+		return err
+	}
+	for _, event := range newEvents {
+		err := c.receiveEvent(event)
+		if err != nil {
+			return err
+		}
+	}
+	if !bounceDisabled {
+		err := c.SendBounces()
+		if err != nil {
+			return err
+		}
+	}
+	if viper.GetBool("complaint_reports") {
+		err := c.SendComplaintReports()
+		if err != nil {
+			return err
+		}
+	}
+	_, err = c.QueryBounceAddrs()
+	if err != nil {
+		return err
+	}
+	return c.PruneBounced()
+}
+
 func (c *Client) PruneEvents() error {
 	err := c.ResetEvents()
 	if err != nil {
@@ -220,137 +431,156 @@ func (c *Client) PruneBounced() error {
 		}
 	}
 
-	return nil
+	err = c.PruneComplaints()
+	if err != nil {
+		return err
+	}
+	return c.PruneDelayed()
+}
+
+// loadEvent reads and parses an event from the events store
+func (c *Client) loadEvent(key string) (events.Event, error) {
+	data, err := c.edb.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	if data == nil {
+		return nil, fmt.Errorf("event not found: %s", key)
+	}
+	return events.ParseEvent(*data)
+}
+
+type failedEvent struct {
+	key   string
+	event *events.Failed
 }
 
 func (c *Client) SendBounces() error {
 
+	err := c.ProcessQueue()
+	if err != nil {
+		return err
+	}
 	keys, err := c.edb.Keys()
 	if err != nil {
 		return err
 	}
+	failures := []failedEvent{}
+	delivered := map[string]bool{}
+	accepted := map[string]time.Time{}
 	for _, key := range keys {
-		data, err := c.edb.Get(key)
-		if err != nil {
-			return err
-		}
-		event, err := events.ParseEvent(*data)
+		event, err := c.loadEvent(key)
 		if err != nil {
 			return err
 		}
-		if event.GetName() == "failed" && !c.bdb.Has(key) {
-			failed := event.(*events.Failed)
-			err = c.sendBounce(failed)
-			if err != nil {
-				return err
-			}
-			if !viper.GetBool("quiet") {
-				log.Printf("sent_bounce: %s <%s> %s\n", key, failed.Message.Headers.MessageID, failed.Recipient)
+		switch e := event.(type) {
+		case *events.Failed:
+			if !c.bdb.Has(key) {
+				failures = append(failures, failedEvent{key, e})
 			}
-			flag := true
-			err = c.bdb.SetObject(key, &flag)
-			if err != nil {
-				return err
+		case *events.Delivered:
+			delivered[deliveryKey(e.Message.Headers.MessageID, e.Recipient)] = true
+		case *events.Accepted:
+			id := strings.Trim(e.Message.Headers.MessageID, "<>")
+			arrival, ok := accepted[id]
+			if !ok || e.GetTimestamp().Before(arrival) {
+				accepted[id] = e.GetTimestamp()
 			}
 		}
 	}
-	return nil
-}
-
-func (c *Client) addPart(mailWriter *mail.Writer, buf *bytes.Buffer) error {
-	part, err := mailWriter.CreateInline()
-	defer part.Close()
-	if err != nil {
-		return err
-	}
-	var header mail.InlineHeader
-	header.Set("Content-Type", "text/plain")
-	writer, err := part.CreatePart(header)
-	defer writer.Close()
-	if err != nil {
-		return err
+	viper.SetDefault("bounce_collect_window", "1m")
+	for _, group := range groupFailures(failures, viper.GetDuration("bounce_collect_window")) {
+		err := c.handleGroup(group, delivered, accepted)
+		if err != nil {
+			return err
+		}
 	}
-	_, err = io.WriteString(writer, buf.String())
+	err = c.expireDelayed(delivered, accepted)
 	if err != nil {
 		return err
 	}
-	return nil
+	return c.SendDigests()
 }
 
-func (c *Client) formatBounce(event *events.Failed, buf *bytes.Buffer) error {
-
-	hostname, err := os.Hostname()
-	if err != nil {
-		return err
+func (c *Client) bounceTransport() (Transport, error) {
+	if c.transport == nil {
+		transport, err := NewTransport()
+		if err != nil {
+			return nil, err
+		}
+		c.transport = transport
 	}
+	return c.transport, nil
+}
 
-	from := []*mail.Address{{Name: "Mailer Daemon", Address: fmt.Sprintf("MAILER-DAEMON@%s", hostname)}}
-	to := []*mail.Address{{Address: event.Envelope.Sender}}
-
-	var mailHeader mail.Header
-	mailHeader.SetDate(time.Now())
-	mailHeader.SetAddressList("From", from)
-	mailHeader.SetAddressList("To", to)
-	mailHeader.SetSubject("Delivery status notification: failed")
-
-	mailWriter, err := mail.CreateWriter(buf, mailHeader)
-	if err != nil {
-		return err
+// deliverBounce applies the suppression rules and the sender rate limit and
+// sends one DSN reporting every item, which all belong to the same message
+// and sender, returning the record for the bounced store; accepted maps
+// Message-IDs to the time mailgun accepted the message
+func (c *Client) deliverBounce(items []bounceItem, accepted map[string]time.Time) (*BounceRecord, error) {
+	failed := items[0].event
+	messageID := failed.Message.Headers.MessageID
+	original := c.originalMessage(failed)
+	reason := c.suppressReason(failed, original)
+	if reason != "" {
+		if !viper.GetBool("quiet") {
+			for _, item := range items {
+				log.Printf("suppressed_bounce: %s <%s> %s %s\n", item.key, messageID, item.event.Recipient, reason)
+			}
+		}
+		return &BounceRecord{Suppressed: reason}, nil
 	}
-	defer mailWriter.Close()
-
-	var pbuf bytes.Buffer
-
-	pbuf.WriteString(`    Hi!
-
-    This is the MAILER-DAEMON, please DO NOT REPLY to this email.
-
-    An error has occurred while attempting to deliver a message
-    for the following list of recipients:
-
-`)
-	pbuf.WriteString(fmt.Sprintf("%s: %v %s\n\n", event.Recipient, event.DeliveryStatus.Code, event.DeliveryStatus.Message))
-	pbuf.WriteString("    Below is a copy of the original message:")
-	err = c.addPart(mailWriter, &pbuf)
-	if err != nil {
-		return err
+	action := groupAction(items)
+	recipients := []RecipientStatus{}
+	for _, item := range items {
+		recipients = append(recipients, c.newRecipientStatus(item.key, item.event, item.action))
 	}
-
-	pbuf.Reset()
-	pbuf.WriteString(fmt.Sprintf("Reporting-MTA: dns; %s; mailgun-relay\n\n", hostname))
-	pbuf.WriteString(fmt.Sprintf("Final-Recipient: rfc822; %s\n", event.Recipient))
-	pbuf.WriteString(fmt.Sprintf("Action: %s failure; %s\n", event.Severity, event.Reason))
-	pbuf.WriteString(fmt.Sprintf("Status: %v", event.DeliveryStatus.Code))
-	err = c.addPart(mailWriter, &pbuf)
+	limited, err := c.rateLimit(failed.Envelope.Sender, recipients)
 	if err != nil {
-		return err
+		return nil, err
 	}
-
-	pbuf.Reset()
-	pbuf.WriteString(fmt.Sprintf("Subject: %s\n", event.Message.Headers.Subject))
-	pbuf.WriteString(fmt.Sprintf("From: %s\n", event.Message.Headers.Subject))
-	pbuf.WriteString(fmt.Sprintf("To: %s\n", event.Message.Headers.Subject))
-	pbuf.WriteString(fmt.Sprintf("Message-ID <%s>", event.Message.Headers.MessageID))
-	err = c.addPart(mailWriter, &pbuf)
+	if limited {
+		if !viper.GetBool("quiet") {
+			for _, item := range items {
+				log.Printf("digest_bounce: %s <%s> %s %s\n", item.key, messageID, item.event.Recipient, failed.Envelope.Sender)
+			}
+		}
+		return &BounceRecord{Action: action, Digest: true}, nil
+	}
+	arrival := accepted[strings.Trim(messageID, "<>")]
+	bounced, err := c.sendBounce(items[0].key, failed, action, recipients, original, arrival)
 	if err != nil {
-		return err
+		return nil, err
 	}
-
-	return nil
+	if !viper.GetBool("quiet") && !bounced.Queued {
+		for _, item := range items {
+			label := "sent_bounce"
+			if item.action == "delayed" {
+				label = "sent_delay_warning"
+			}
+			log.Printf("%s: %s <%s> %s\n", label, item.key, messageID, item.event.Recipient)
+		}
+	}
+	bounced.Action = action
+	return bounced, nil
 }
 
-func (c *Client) sendBounce(failed *events.Failed) error {
+// sendBounce formats, signs and delivers a bounce, returning the delivery
+// details for the bounced store
+func (c *Client) sendBounce(key string, failed *events.Failed, action string, recipients []RecipientStatus, original []byte, arrival time.Time) (*BounceRecord, error) {
 
 	var buf bytes.Buffer
-	err := c.formatBounce(failed, &buf)
+	err := c.formatGroupBounce(failed, action, recipients, original, arrival, &buf)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	cmd := exec.Command("sendmail", "-t")
-	cmd.Stdin = bytes.NewReader(buf.Bytes())
-	output, err := cmd.CombinedOutput()
+	message, err := c.signBounce(buf.Bytes())
 	if err != nil {
-		return fmt.Errorf("sendmail failed: %s", string(output))
+		return nil, err
 	}
-	return nil
+	queued, err := c.deliverMessage(key, failed.Envelope.Sender, message)
+	if err != nil {
+		return nil, err
+	}
+	return newDeliveryRecord(c.transport, message, queued), nil
 }
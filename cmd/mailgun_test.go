@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"fmt"
+	"github.com/spf13/viper"
 	"github.com/stretchr/testify/require"
 	"testing"
 )
@@ -13,6 +14,9 @@ func initTestConfig() {
 
 func TestEvents(t *testing.T) {
 	initTestConfig()
+	if viper.GetString("api_key") == "" {
+		t.Skip("api_key is not configured")
+	}
 	api := NewClient()
 	events, err := api.QueryEvents()
 	require.Nil(t, err)
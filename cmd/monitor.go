@@ -31,29 +31,73 @@ POSSIBILITY OF SUCH DAMAGE.
 package cmd
 
 import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
-	"log"
 )
 
+var monitorAllDomains bool
+
 var monitorCmd = &cobra.Command{
-	Use:   "monitor",
+	Use:   "monitor [DOMAIN...]",
 	Short: "await and process mailgun events",
 	Long: `
 Connect to the mailgun API and continuously poll for new events.  When new
 events arrive, store them to the cache db and send any required bounces.
+
+With a list of domains, or with --all-domains for every active domain of
+the account, one poller runs for each domain under a supervisor that
+restarts a failed poller after monitor_restart_delay.  Each domain keeps its
+stores in a subdirectory of the data root named for the domain, which other
+commands can use with --data-root and --domain.  With --all-domains the
+account is checked for added or removed domains every
+domain_discovery_interval.  The domains are processed concurrently.
+
+New events received by monitor, webhook serve or events --follow --process
+are forwarded to each sink listed in event_sinks before they are stored;
+events stored by the events, trace and prune commands or by events --follow
+without --process are not.  A sink has
+a type of syslog (RFC 5424 over network unix, udp or tcp to address, with
+facility and tag), exec (command run with the event JSON on stdin), http
+(event JSON POSTed to url with headers, retried up to retries times
+starting at retry_delay) or unix (a line of JSON written to the stream
+socket at address), an optional list of event types to forward, a timeout,
+and an on_failure policy: ignore (the default) logs the failure, disable
+stops using the sink, and fail holds the event in memory, out of the events
+store and the bounce pipeline, and forwards it again to the failed sinks
+before each later batch of events is processed until they accept it.  Held
+events are lost when the process exits.
 `,
 	Run: func(cmd *cobra.Command, args []string) {
+		if monitorAllDomains && len(args) > 0 {
+			cobra.CheckErr(fmt.Errorf("--all-domains cannot be used with a domain list"))
+		}
 		DaemonizeDisabled = viper.GetBool("foreground")
 		Daemonize(func() {
-			log.Printf("monitoring events")
-			api := NewClient()
-			err := api.MonitorEvents()
+			if !monitorAllDomains && len(args) == 0 {
+				log.Printf("monitoring events")
+				api := NewClient()
+				err := api.MonitorEvents()
+				cobra.CheckErr(err)
+				return
+			}
+			supervisor, err := NewSupervisor(args)
 			cobra.CheckErr(err)
+			if monitorAllDomains {
+				log.Printf("monitoring events for all domains")
+			} else {
+				log.Printf("monitoring events for %s", strings.Join(args, " "))
+			}
+			supervisor.Run(context.Background())
 		}, "/var/log/mailgun")
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(monitorCmd)
+	monitorCmd.Flags().BoolVarP(&monitorAllDomains, "all-domains", "a", false, "monitor every active domain")
 }
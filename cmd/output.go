@@ -0,0 +1,215 @@
+package cmd
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+// output formats selected by --output; text is the default layout of a
+// command, which is the table for commands without a layout of their own
+const (
+	OutputText     = "text"
+	OutputTable    = "table"
+	OutputJSON     = "json"
+	OutputNDJSON   = "ndjson"
+	OutputCSV      = "csv"
+	OutputYAML     = "yaml"
+	OutputTemplate = "template"
+)
+
+var outputFormats = []string{OutputText, OutputTable, OutputJSON, OutputNDJSON, OutputCSV, OutputYAML, OutputTemplate + "=TEXT"}
+
+// OutputFormat returns the format named by --output, json when only --json
+// is set, or the command default
+func OutputFormat(defaultFormat string) string {
+	format := viper.GetString("output")
+	if format != "" {
+		return format
+	}
+	if viper.GetBool("json") {
+		return OutputJSON
+	}
+	return defaultFormat
+}
+
+// Output writes the records of a listing command in a structured format.
+// Table and CSV output use the row values of the selected columns; the
+// other formats use the JSON encoding of each record, and a template is
+// executed with that encoding decoded into maps, so its fields have the
+// names seen in the json output, e.g. {{.recipient}}
+type Output struct {
+	format   string
+	writer   io.Writer
+	columns  []string
+	noHeader bool
+	template *template.Template
+	csv      *csv.Writer
+	table    *Table
+	records  []any
+	started  bool
+}
+
+// NewOutput returns an Output writing format to w
+func NewOutput(w io.Writer, format string, columns []string, noHeader bool) (*Output, error) {
+	o := Output{
+		format:   format,
+		writer:   w,
+		columns:  columns,
+		noHeader: noHeader,
+		records:  []any{},
+	}
+	name, text, _ := strings.Cut(format, "=")
+	if name != OutputTemplate {
+		name = format
+	}
+	switch name {
+	case OutputText, OutputTable:
+		o.format = OutputTable
+		o.table = &Table{Columns: columns, NoHeader: noHeader, Width: terminalWidth()}
+	case OutputCSV:
+		o.csv = csv.NewWriter(w)
+	case OutputJSON, OutputNDJSON, OutputYAML:
+	case OutputTemplate:
+		if text == "" {
+			return nil, fmt.Errorf("output template required: --output 'template={{.id}}'")
+		}
+		text = strings.NewReplacer(`\n`, "\n", `\t`, "\t").Replace(text)
+		if !strings.HasSuffix(text, "\n") {
+			text += "\n"
+		}
+		tmpl, err := template.New("output").Option("missingkey=zero").Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("output template: %v", err)
+		}
+		o.format = OutputTemplate
+		o.template = tmpl
+	default:
+		return nil, fmt.Errorf("unknown output format '%s'; formats are: %s", format, strings.Join(outputFormats, ", "))
+	}
+	return &o, nil
+}
+
+// genericValue returns the JSON encoding of a record decoded into maps,
+// slices and scalars
+func genericValue(record any) (any, error) {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return nil, err
+	}
+	var value any
+	err = json.Unmarshal(data, &value)
+	if err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// Write outputs a record, or holds it until Close for the formats that
+// enclose all records
+func (o *Output) Write(record any, row map[string]string) error {
+	switch o.format {
+	case OutputTable:
+		o.table.Rows = append(o.table.Rows, row)
+	case OutputCSV:
+		if !o.started && !o.noHeader {
+			err := o.csv.Write(o.columns)
+			if err != nil {
+				return err
+			}
+		}
+		values := make([]string, len(o.columns))
+		for i, column := range o.columns {
+			values[i] = row[column]
+		}
+		err := o.csv.Write(values)
+		if err != nil {
+			return err
+		}
+	case OutputNDJSON:
+		data, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(o.writer, string(data))
+		if err != nil {
+			return err
+		}
+	case OutputTemplate:
+		value, err := genericValue(record)
+		if err != nil {
+			return err
+		}
+		err = o.template.Execute(o.writer, value)
+		if err != nil {
+			return err
+		}
+	default:
+		o.records = append(o.records, record)
+	}
+	o.started = true
+	return nil
+}
+
+// Streaming returns true when the format writes each record as it arrives
+// rather than enclosing all records in one document
+func (o *Output) Streaming() bool {
+	return o.format != OutputJSON && o.format != OutputYAML
+}
+
+// Flush writes the records held for table and csv output; table rows
+// flushed later are aligned to the columns of the first rows
+func (o *Output) Flush() error {
+	switch o.format {
+	case OutputTable:
+		if len(o.table.Rows) == 0 {
+			return nil
+		}
+		return o.table.Append(o.writer)
+	case OutputCSV:
+		o.csv.Flush()
+		return o.csv.Error()
+	}
+	return nil
+}
+
+// Close completes the output
+func (o *Output) Close() error {
+	switch o.format {
+	case OutputTable:
+		if o.table.started {
+			return o.table.Append(o.writer)
+		}
+		return o.table.Write(o.writer)
+	case OutputCSV:
+		if !o.started && !o.noHeader {
+			err := o.csv.Write(o.columns)
+			if err != nil {
+				return err
+			}
+		}
+		o.csv.Flush()
+		return o.csv.Error()
+	case OutputJSON:
+		_, err := fmt.Fprintln(o.writer, FormatJSON(o.records))
+		return err
+	case OutputYAML:
+		value, err := genericValue(o.records)
+		if err != nil {
+			return err
+		}
+		data, err := yaml.Marshal(value)
+		if err != nil {
+			return err
+		}
+		_, err = o.writer.Write(data)
+		return err
+	}
+	return nil
+}
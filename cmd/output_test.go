@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/mailgun/mailgun-go/v5/mtypes"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+)
+
+func writeTestOutput(t *testing.T, format string) string {
+	bounces := []mtypes.Bounce{
+		{Address: "nobody@example.org", Code: "550", Error: "no such user, \"nobody\""},
+		{Address: "full@example.org", Code: "452", Error: "mailbox full"},
+	}
+	var buf bytes.Buffer
+	output, err := NewOutput(&buf, format, []string{"address", "code"}, false)
+	require.Nil(t, err)
+	for _, bounce := range bounces {
+		require.Nil(t, output.Write(bounce, bounceRow(&bounce)))
+	}
+	require.Nil(t, output.Close())
+	return buf.String()
+}
+
+func TestOutputFormats(t *testing.T) {
+	require.Equal(t, ""+
+		"ADDRESS             CODE\n"+
+		"nobody@example.org  550\n"+
+		"full@example.org    452\n", writeTestOutput(t, "table"))
+	require.Equal(t, writeTestOutput(t, "table"), writeTestOutput(t, "text"))
+
+	require.Equal(t, ""+
+		"address,code\n"+
+		"nobody@example.org,550\n"+
+		"full@example.org,452\n", writeTestOutput(t, "csv"))
+
+	ndjson := writeTestOutput(t, "ndjson")
+	lines := bytes.Split(bytes.TrimSpace([]byte(ndjson)), []byte("\n"))
+	require.Len(t, lines, 2)
+	require.Contains(t, string(lines[0]), `"address":"nobody@example.org"`)
+	require.Contains(t, string(lines[1]), `"error":"mailbox full"`)
+
+	json := writeTestOutput(t, "json")
+	require.Contains(t, json, "[\n  {\n")
+	require.Contains(t, json, `"address": "full@example.org"`)
+
+	yaml := writeTestOutput(t, "yaml")
+	require.Contains(t, yaml, "- address: nobody@example.org\n")
+	require.Contains(t, yaml, "  code: \"452\"\n")
+
+	require.Equal(t, ""+
+		"nobody@example.org: no such user, \"nobody\"\n"+
+		"full@example.org: mailbox full\n", writeTestOutput(t, "template={{.address}}: {{.error}}"))
+}
+
+func TestOutputErrors(t *testing.T) {
+	for _, format := range []string{"xml", "template=", "template={{.address", "json=x"} {
+		_, err := NewOutput(&bytes.Buffer{}, format, nil, false)
+		require.NotNil(t, err, format)
+	}
+}
+
+func TestOutputFormat(t *testing.T) {
+	defer viper.Set("output", "")
+	defer viper.Set("json", false)
+	viper.Set("output", "")
+	viper.Set("json", false)
+	require.Equal(t, OutputTable, OutputFormat(OutputTable))
+	viper.Set("json", true)
+	require.Equal(t, OutputJSON, OutputFormat(OutputTable))
+	viper.Set("output", "csv")
+	require.Equal(t, OutputCSV, OutputFormat(OutputTable))
+}
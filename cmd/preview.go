@@ -0,0 +1,131 @@
+/*
+Copyright © 2025 Matt Krueger <mkrueger@rstms.net>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+ 1. Redistributions of source code must retain the above copyright notice,
+    this list of conditions and the following disclaimer.
+
+ 2. Redistributions in binary form must reproduce the above copyright notice,
+    this list of conditions and the following disclaimer in the documentation
+    and/or other materials provided with the distribution.
+
+ 3. Neither the name of the copyright holder nor the names of its contributors
+    may be used to endorse or promote products derived from this software
+    without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+POSSIBILITY OF SUCH DAMAGE.
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/mailgun/mailgun-go/v5/events"
+	"github.com/spf13/cobra"
+)
+
+var previewEventFile string
+var previewWrite string
+var previewMaildir string
+var previewAction string
+var previewNoOriginal bool
+
+var previewCmd = &cobra.Command{
+	Use:   "preview [EVENT_ID]",
+	Short: "render a bounce without sending it",
+	Long: `
+Render the bounce message for a failed event from the mailgun.events store,
+or from a JSON file with --event-file, and write it to stdout, to a file with
+--write, or into a Maildir with --maildir.  The bounce is never sent and the
+mailgun.bounced store is not modified.
+`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		api := NewClient()
+		var event events.Event
+		var err error
+		switch {
+		case previewEventFile != "":
+			data, err := os.ReadFile(previewEventFile)
+			cobra.CheckErr(err)
+			event, err = events.ParseEvent(data)
+			cobra.CheckErr(err)
+		case len(args) == 1:
+			event, err = api.loadEvent(args[0])
+			cobra.CheckErr(err)
+		default:
+			cobra.CheckErr(fmt.Errorf("event ID or --event-file required"))
+		}
+		failed, ok := event.(*events.Failed)
+		if !ok {
+			cobra.CheckErr(fmt.Errorf("event %s is a '%s' event, not 'failed'", event.GetID(), event.GetName()))
+		}
+		data, err := api.PreviewBounce(failed, previewAction, !previewNoOriginal)
+		cobra.CheckErr(err)
+		switch {
+		case previewMaildir != "":
+			pathname, err := writeMaildir(previewMaildir, data)
+			cobra.CheckErr(err)
+			fmt.Println(pathname)
+		case previewWrite != "":
+			err := os.WriteFile(previewWrite, data, 0600)
+			cobra.CheckErr(err)
+		default:
+			_, err := os.Stdout.Write(data)
+			cobra.CheckErr(err)
+		}
+	},
+}
+
+// writeMaildir delivers a message into the new directory of a Maildir,
+// creating the Maildir if necessary, and returns the message pathname
+func writeMaildir(dir string, data []byte) (string, error) {
+	for _, sub := range []string{"tmp", "new", "cur"} {
+		err := os.MkdirAll(filepath.Join(dir, sub), 0700)
+		if err != nil {
+			return "", err
+		}
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	filename := fmt.Sprintf("%d.M%dP%d.%s", now.Unix(), now.Nanosecond()/1000, os.Getpid(), hostname)
+	tmpPath := filepath.Join(dir, "tmp", filename)
+	err = os.WriteFile(tmpPath, data, 0600)
+	if err != nil {
+		return "", err
+	}
+	newPath := filepath.Join(dir, "new", filename)
+	err = os.Rename(tmpPath, newPath)
+	if err != nil {
+		return "", err
+	}
+	return newPath, nil
+}
+
+func init() {
+	bounceCmd.AddCommand(previewCmd)
+	previewCmd.Flags().StringVarP(&previewEventFile, "event-file", "e", "", "read the failed event from a JSON file")
+	previewCmd.Flags().StringVarP(&previewWrite, "write", "w", "", "write the bounce to a file")
+	previewCmd.Flags().StringVarP(&previewMaildir, "maildir", "m", "", "deliver the bounce into a Maildir")
+	previewCmd.Flags().StringVarP(&previewAction, "action", "a", "", "DSN action, failed or delayed (default from event severity)")
+	previewCmd.Flags().BoolVar(&previewNoOriginal, "no-original", false, "do not fetch the stored original message")
+}
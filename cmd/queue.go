@@ -0,0 +1,267 @@
+package cmd
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// QueuedBounce is a formatted bounce whose delivery failed, persisted in the
+// mailgun.queue store until it is sent or moved to mailgun.deadletter
+type QueuedBounce struct {
+	ID          string    `json:"id"`
+	EventKey    string    `json:"event_key,omitempty"`
+	Sender      string    `json:"sender"`
+	Recipients  []string  `json:"recipients"`
+	Message     []byte    `json:"message"`
+	Attempts    int       `json:"attempts"`
+	Queued      time.Time `json:"queued"`
+	LastAttempt time.Time `json:"last_attempt"`
+	NextAttempt time.Time `json:"next_attempt"`
+	LastError   string    `json:"last_error"`
+	Dead        bool      `json:"dead,omitempty"`
+}
+
+func initQueueConfig() {
+	viper.SetDefault("bounce_retry_interval", "1m")
+	viper.SetDefault("bounce_retry_max_interval", "6h")
+	viper.SetDefault("bounce_retry_max_attempts", 10)
+}
+
+// retryDelay returns the exponential backoff after the given number of
+// failed attempts, doubling bounce_retry_interval up to
+// bounce_retry_max_interval
+func retryDelay(attempts int) time.Duration {
+	delay := viper.GetDuration("bounce_retry_interval")
+	limit := viper.GetDuration("bounce_retry_max_interval")
+	for i := 1; i < attempts && delay < limit; i++ {
+		delay *= 2
+	}
+	if delay > limit {
+		delay = limit
+	}
+	return delay
+}
+
+func newQueueID() (string, error) {
+	id := make([]byte, 8)
+	_, err := rand.Read(id)
+	if err != nil {
+		return "", err
+	}
+	return time.Now().UTC().Format("20060102150405") + "-" + hex.EncodeToString(id), nil
+}
+
+// deliverMessage sends a formatted bounce, queueing it for retry when the
+// transport fails; true is returned if the message was queued
+func (c *Client) deliverMessage(key, recipient string, message []byte) (bool, error) {
+	recipient = normalizeAddress(recipient)
+	identity, err := LoadBounceIdentity(c.domain)
+	if err != nil {
+		return false, err
+	}
+	transport, err := c.bounceTransport()
+	if err != nil {
+		return false, err
+	}
+	sendErr := transport.Send(identity.EnvelopeSender, []string{recipient}, message)
+	if sendErr == nil {
+		return false, nil
+	}
+	id, err := newQueueID()
+	if err != nil {
+		return false, err
+	}
+	now := time.Now()
+	item := QueuedBounce{
+		ID:          id,
+		EventKey:    key,
+		Sender:      identity.EnvelopeSender,
+		Recipients:  []string{recipient},
+		Message:     message,
+		Attempts:    1,
+		Queued:      now,
+		LastAttempt: now,
+		NextAttempt: now.Add(retryDelay(1)),
+		LastError:   sendErr.Error(),
+	}
+	if !viper.GetBool("quiet") {
+		log.Printf("queued_bounce: %s %s %s %v\n", id, key, recipient, sendErr)
+	}
+	return true, c.qdb.SetObject(id, &item)
+}
+
+// ProcessQueue retries each queued bounce that is due, moving it to the
+// dead-letter store once bounce_retry_max_attempts have failed
+func (c *Client) ProcessQueue() error {
+	items, err := c.QueuedBounces(false)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, item := range items {
+		if item.NextAttempt.After(now) {
+			continue
+		}
+		err := c.retryBounce(&item)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RetryQueued immediately retries the queued or dead-lettered bounces with
+// the given IDs, or every queued bounce if no IDs are given
+func (c *Client) RetryQueued(ids []string) error {
+	if len(ids) == 0 {
+		items, err := c.QueuedBounces(false)
+		if err != nil {
+			return err
+		}
+		for _, item := range items {
+			ids = append(ids, item.ID)
+		}
+	}
+	for _, id := range ids {
+		item, err := c.queuedBounce(id)
+		if err != nil {
+			return err
+		}
+		if item.Dead {
+			item.Dead = false
+			item.Attempts = 0
+		}
+		err = c.retryBounce(item)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DropQueued removes queued or dead-lettered bounces without sending them
+func (c *Client) DropQueued(ids []string) error {
+	for _, id := range ids {
+		item, err := c.queuedBounce(id)
+		if err != nil {
+			return err
+		}
+		db := c.qdb
+		if item.Dead {
+			db = c.xdb
+		}
+		err = db.Clear(id)
+		if err != nil {
+			return err
+		}
+		if !viper.GetBool("quiet") {
+			log.Printf("dropped_bounce: %s %s\n", id, item.EventKey)
+		}
+	}
+	return nil
+}
+
+// QueuedBounces returns the queued bounces, followed by the dead-lettered
+// ones if dead is true, each in order of first queueing
+func (c *Client) QueuedBounces(dead bool) ([]QueuedBounce, error) {
+	stores := []*DB{c.qdb}
+	if dead {
+		stores = append(stores, c.xdb)
+	}
+	items := []QueuedBounce{}
+	for _, db := range stores {
+		keys, err := db.Keys()
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			var item QueuedBounce
+			_, err := db.GetObject(key, &item)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
+
+func (c *Client) queuedBounce(id string) (*QueuedBounce, error) {
+	var item QueuedBounce
+	switch {
+	case c.qdb.Has(id):
+		_, err := c.qdb.GetObject(id, &item)
+		return &item, err
+	case c.xdb.Has(id):
+		_, err := c.xdb.GetObject(id, &item)
+		return &item, err
+	}
+	return nil, fmt.Errorf("queued bounce not found: %s", id)
+}
+
+// retryBounce makes one delivery attempt for a queued or dead-lettered
+// bounce and updates the queue; transport failures are recorded rather than
+// returned, and the item stays where it was stored until it is sent, queued
+// or dead-lettered again
+func (c *Client) retryBounce(item *QueuedBounce) error {
+	transport, err := c.bounceTransport()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	item.Attempts++
+	item.LastAttempt = now
+	sendErr := transport.Send(item.Sender, item.Recipients, item.Message)
+	if sendErr == nil {
+		if !viper.GetBool("quiet") {
+			log.Printf("sent_queued_bounce: %s %s attempts=%d\n", item.ID, item.EventKey, item.Attempts)
+		}
+		err := c.markSent(item.EventKey, transport)
+		if err != nil {
+			return err
+		}
+		return c.clearQueued(item.ID, c.qdb, c.xdb)
+	}
+	item.LastError = sendErr.Error()
+	if item.Attempts >= viper.GetInt("bounce_retry_max_attempts") {
+		item.Dead = true
+		item.NextAttempt = time.Time{}
+		if !viper.GetBool("quiet") {
+			log.Printf("dead_letter_bounce: %s %s attempts=%d %v\n", item.ID, item.EventKey, item.Attempts, sendErr)
+		}
+		err := c.xdb.SetObject(item.ID, item)
+		if err != nil {
+			return err
+		}
+		return c.clearQueued(item.ID, c.qdb)
+	}
+	item.NextAttempt = now.Add(retryDelay(item.Attempts))
+	if !viper.GetBool("quiet") {
+		log.Printf("retry_failed_bounce: %s %s attempts=%d next=%s %v\n", item.ID, item.EventKey, item.Attempts, item.NextAttempt.Format(time.RFC3339), sendErr)
+	}
+	err = c.qdb.SetObject(item.ID, item)
+	if err != nil {
+		return err
+	}
+	return c.clearQueued(item.ID, c.xdb)
+}
+
+// clearQueued removes a bounce from the stores holding it
+func (c *Client) clearQueued(id string, stores ...*DB) error {
+	for _, db := range stores {
+		if db.Has(id) {
+			err := db.Clear(id)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
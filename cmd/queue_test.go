@@ -0,0 +1,169 @@
+package cmd
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+)
+
+// flakyTransport fails every send while down is set
+type flakyTransport struct {
+	recordingTransport
+	down     bool
+	attempts int
+}
+
+func (t *flakyTransport) Send(sender string, recipients []string, message []byte) error {
+	t.attempts++
+	if t.down {
+		return fmt.Errorf("sendmail failed: exit status 75")
+	}
+	return t.recordingTransport.Send(sender, recipients, message)
+}
+
+func TestRetryDelay(t *testing.T) {
+	initTestConfig()
+	initQueueConfig()
+	viper.Set("bounce_retry_interval", "1m")
+	viper.Set("bounce_retry_max_interval", "10m")
+	defer viper.Set("bounce_retry_max_interval", "6h")
+	require.Equal(t, time.Minute, retryDelay(1))
+	require.Equal(t, 2*time.Minute, retryDelay(2))
+	require.Equal(t, 8*time.Minute, retryDelay(4))
+	require.Equal(t, 10*time.Minute, retryDelay(5))
+	require.Equal(t, 10*time.Minute, retryDelay(50))
+}
+
+func TestBounceQueue(t *testing.T) {
+	api, _ := newTestClient(t)
+	transport := flakyTransport{down: true}
+	api.transport = &transport
+	viper.Set("bounce_retry_interval", "0s")
+	viper.Set("bounce_retry_max_attempts", 3)
+	defer viper.Set("bounce_retry_interval", "1m")
+	defer viper.Set("bounce_retry_max_attempts", 10)
+
+	// a transport failure queues the bounce instead of failing the run
+	require.Nil(t, api.storeEvent(failedVariant(t, "queued", "permanent")))
+	require.Nil(t, api.SendBounces())
+	record, err := api.BouncedRecord("queued")
+	require.Nil(t, err)
+	require.True(t, record.Queued)
+	items, err := api.QueuedBounces(true)
+	require.Nil(t, err)
+	require.Len(t, items, 1)
+	require.Equal(t, 1, items[0].Attempts)
+	require.Equal(t, []string{"alice@example.com"}, items[0].Recipients)
+	require.Contains(t, items[0].LastError, "exit status 75")
+
+	// retries on later runs, then moves to the dead-letter store
+	require.Nil(t, api.SendBounces())
+	require.Nil(t, api.SendBounces())
+	items, err = api.QueuedBounces(false)
+	require.Nil(t, err)
+	require.Empty(t, items)
+	items, err = api.QueuedBounces(true)
+	require.Nil(t, err)
+	require.Len(t, items, 1)
+	require.True(t, items[0].Dead)
+	require.Equal(t, 3, items[0].Attempts)
+	require.Equal(t, 3, transport.attempts)
+	require.Nil(t, api.SendBounces())
+	require.Equal(t, 3, transport.attempts)
+
+	// a dead letter is kept when the transport cannot be configured
+	api.transport = nil
+	viper.Set("bounce_transport", "smtp")
+	viper.Set("smtp_tls", "carrier-pigeon")
+	require.NotNil(t, api.RetryQueued([]string{items[0].ID}))
+	viper.Set("bounce_transport", "sendmail")
+	viper.Set("smtp_tls", "none")
+	api.transport = &transport
+	dead, err := api.QueuedBounces(true)
+	require.Nil(t, err)
+	require.Len(t, dead, 1)
+	require.True(t, dead[0].Dead)
+
+	// a dead letter retried while the transport is down is queued again
+	require.Nil(t, api.RetryQueued([]string{items[0].ID}))
+	queued, err := api.QueuedBounces(true)
+	require.Nil(t, err)
+	require.Len(t, queued, 1)
+	require.False(t, queued[0].Dead)
+	require.Equal(t, 1, queued[0].Attempts)
+
+	// a bounce can be retried by ID once the transport recovers
+	transport.down = false
+	require.Nil(t, api.RetryQueued([]string{items[0].ID}))
+	require.Len(t, transport.messages, 1)
+	require.Equal(t, items[0].Message, transport.messages[0].Data)
+	record, err = api.BouncedRecord("queued")
+	require.Nil(t, err)
+	require.False(t, record.Queued)
+	require.Equal(t, "recording", record.Transport)
+	items, err = api.QueuedBounces(true)
+	require.Nil(t, err)
+	require.Empty(t, items)
+}
+
+func TestBounceQueueBackoff(t *testing.T) {
+	api, _ := newTestClient(t)
+	transport := flakyTransport{down: true}
+	api.transport = &transport
+	viper.Set("bounce_retry_interval", "1h")
+	defer viper.Set("bounce_retry_interval", "1m")
+
+	require.Nil(t, api.storeEvent(failedVariant(t, "backoff", "permanent")))
+	require.Nil(t, api.SendBounces())
+	require.Nil(t, api.SendBounces())
+	require.Equal(t, 1, transport.attempts)
+
+	items, err := api.QueuedBounces(false)
+	require.Nil(t, err)
+	require.Len(t, items, 1)
+	require.WithinDuration(t, time.Now().Add(time.Hour), items[0].NextAttempt, time.Minute)
+
+	require.Nil(t, api.DropQueued([]string{items[0].ID}))
+	items, err = api.QueuedBounces(true)
+	require.Nil(t, err)
+	require.Empty(t, items)
+	require.NotNil(t, api.DropQueued([]string{"missing"}))
+}
+
+// commandFlagSet merges the flags of a command with the persistent flags of
+// its parents, failing as cobra does on a shorthand defined twice
+func commandFlagSet(cmd *cobra.Command) (flags *pflag.FlagSet, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%s: %v", cmd.CommandPath(), r)
+		}
+	}()
+	flags = pflag.NewFlagSet(cmd.Name(), pflag.ContinueOnError)
+	flags.AddFlagSet(cmd.Flags())
+	for parent := cmd.Parent(); parent != nil; parent = parent.Parent() {
+		flags.AddFlagSet(parent.PersistentFlags())
+	}
+	return flags, nil
+}
+
+func TestCommandFlags(t *testing.T) {
+	flags, err := commandFlagSet(queueListCmd)
+	require.Nil(t, err)
+	require.NotNil(t, flags.ShorthandLookup("D"))
+	require.Equal(t, "domain", flags.ShorthandLookup("d").Name)
+
+	var check func(cmd *cobra.Command)
+	check = func(cmd *cobra.Command) {
+		_, err := commandFlagSet(cmd)
+		require.Nil(t, err)
+		for _, child := range cmd.Commands() {
+			check(child)
+		}
+	}
+	check(rootCmd)
+}
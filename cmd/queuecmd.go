@@ -0,0 +1,160 @@
+/*
+Copyright © 2025 Matt Krueger <mkrueger@rstms.net>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+ 1. Redistributions of source code must retain the above copyright notice,
+    this list of conditions and the following disclaimer.
+
+ 2. Redistributions in binary form must reproduce the above copyright notice,
+    this list of conditions and the following disclaimer in the documentation
+    and/or other materials provided with the distribution.
+
+ 3. Neither the name of the copyright holder nor the names of its contributors
+    may be used to endorse or promote products derived from this software
+    without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+POSSIBILITY OF SUCH DAMAGE.
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var queueDead bool
+var queueDropAll bool
+
+var queueCmd = &cobra.Command{
+	Use:   "queue",
+	Short: "manage the bounce retry queue",
+	Long: `
+Bounces that fail to send are kept in the mailgun.queue store and retried
+with exponential backoff, starting at bounce_retry_interval and doubling up
+to bounce_retry_max_interval.  After bounce_retry_max_attempts failures a
+bounce is moved to the mailgun.deadletter store, where it stays until it is
+retried or dropped.
+`,
+}
+
+var queueListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "list queued bounces",
+	Long: `
+List the bounces awaiting retry, and with --dead the dead-lettered bounces.
+`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		api := NewClient()
+		items, err := api.QueuedBounces(queueDead)
+		cobra.CheckErr(err)
+		format := OutputFormat(OutputText)
+		if format != OutputText {
+			output, err := NewOutput(os.Stdout, format, queueColumns, false)
+			cobra.CheckErr(err)
+			for _, item := range items {
+				cobra.CheckErr(output.Write(item, queueRow(&item)))
+			}
+			cobra.CheckErr(output.Close())
+			return
+		}
+		for _, item := range items {
+			state := "queued"
+			next := item.NextAttempt.Format(time.RFC3339)
+			if item.Dead {
+				state = "dead"
+				next = "-"
+			}
+			fmt.Printf("%s %s attempts=%d next=%s to=%v event=%s error=%q\n",
+				item.ID, state, item.Attempts, next, item.Recipients, item.EventKey, item.LastError)
+		}
+	},
+}
+
+var queueColumns = []string{"id", "state", "attempts", "next", "recipients", "event", "error"}
+
+// queueRow returns the table column values for a queued bounce
+func queueRow(item *QueuedBounce) map[string]string {
+	state := "queued"
+	next := item.NextAttempt.Format(time.RFC3339)
+	if item.Dead {
+		state = "dead"
+		next = ""
+	}
+	return map[string]string{
+		"id":         item.ID,
+		"state":      state,
+		"attempts":   strconv.Itoa(item.Attempts),
+		"next":       next,
+		"recipients": strings.Join(item.Recipients, " "),
+		"event":      item.EventKey,
+		"error":      item.LastError,
+	}
+}
+
+var queueRetryCmd = &cobra.Command{
+	Use:   "retry [ID...]",
+	Short: "retry queued bounces now",
+	Long: `
+Attempt delivery of the named queued or dead-lettered bounces immediately,
+or of every queued bounce when no ID is given.  A dead-lettered bounce is
+returned to the queue with its attempt count reset if delivery fails again.
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		api := NewClient()
+		err := api.RetryQueued(args)
+		cobra.CheckErr(err)
+	},
+}
+
+var queueDropCmd = &cobra.Command{
+	Use:   "drop [ID...]",
+	Short: "delete queued bounces without sending",
+	Long: `
+Delete the named queued or dead-lettered bounces, or with --all every
+dead-lettered bounce.
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		api := NewClient()
+		if queueDropAll {
+			items, err := api.QueuedBounces(true)
+			cobra.CheckErr(err)
+			for _, item := range items {
+				if item.Dead {
+					args = append(args, item.ID)
+				}
+			}
+		} else if len(args) == 0 {
+			cobra.CheckErr(fmt.Errorf("queued bounce ID or --all required"))
+		}
+		err := api.DropQueued(args)
+		cobra.CheckErr(err)
+	},
+}
+
+func init() {
+	bounceCmd.AddCommand(queueCmd)
+	queueCmd.AddCommand(queueListCmd)
+	queueCmd.AddCommand(queueRetryCmd)
+	queueCmd.AddCommand(queueDropCmd)
+	queueListCmd.Flags().BoolVarP(&queueDead, "dead", "D", false, "include dead-lettered bounces")
+	queueDropCmd.Flags().BoolVarP(&queueDropAll, "all", "a", false, "drop every dead-lettered bounce")
+}
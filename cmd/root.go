@@ -71,6 +71,7 @@ func init() {
 	OptionSwitch("foreground", "", "do not daemonize monitor")
 	OptionSwitch("quiet", "q", "suppress non-error output")
 	OptionSwitch("json", "j", "output JSON objects")
+	OptionString("output", "o", "", "output format: text, table, json, ndjson, csv, yaml or template=TEXT")
 	OptionSwitch("no-bounce", "", "disable automatic bounce generation")
 	OptionSwitch("no-delete", "", "disable deletion of bounced addresses")
 	hostname, err := os.Hostname()
@@ -108,5 +109,17 @@ func initConfig() {
 			fmt.Fprintln(os.Stderr, "Using config file:", viper.ConfigFileUsed())
 		}
 	}
+	initDefaults()
 	InitLog()
 }
+
+// initDefaults sets the config defaults once at startup, so that event
+// processing only reads the config
+func initDefaults() {
+	initClientConfig()
+	initTransportConfig()
+	initLimiterConfig()
+	initQueueConfig()
+	initWebhookConfig()
+	initSupervisorConfig()
+}
@@ -0,0 +1,439 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mailgun/mailgun-go/v5/events"
+	"github.com/spf13/viper"
+)
+
+// failure policies of an event sink
+const (
+	SinkFailureIgnore  = "ignore"
+	SinkFailureDisable = "disable"
+	SinkFailureFail    = "fail"
+)
+
+// Sink publishes a newly stored event to an external destination
+type Sink interface {
+	Name() string
+	Publish(event events.Event, data []byte) error
+}
+
+// SinkConfig is an entry of the event_sinks config list; the fields used
+// depend on the sink type
+type SinkConfig struct {
+	Name       string            `mapstructure:"name"`
+	Type       string            `mapstructure:"type"`
+	Events     []string          `mapstructure:"events"`
+	OnFailure  string            `mapstructure:"on_failure"`
+	Network    string            `mapstructure:"network"`
+	Address    string            `mapstructure:"address"`
+	Facility   string            `mapstructure:"facility"`
+	Tag        string            `mapstructure:"tag"`
+	Command    []string          `mapstructure:"command"`
+	URL        string            `mapstructure:"url"`
+	Headers    map[string]string `mapstructure:"headers"`
+	Retries    int               `mapstructure:"retries"`
+	RetryDelay string            `mapstructure:"retry_delay"`
+	Timeout    string            `mapstructure:"timeout"`
+}
+
+// EventSink applies the event type filter and failure policy of a sink
+type EventSink struct {
+	sink      Sink
+	events    map[string]bool
+	onFailure string
+	mutex     sync.Mutex
+	disabled  bool
+}
+
+// LoadEventSinks returns the sinks configured in the event_sinks list
+func LoadEventSinks() ([]*EventSink, error) {
+	configs := []SinkConfig{}
+	err := viper.UnmarshalKey("event_sinks", &configs)
+	if err != nil {
+		return nil, fmt.Errorf("event_sinks: %v", err)
+	}
+	sinks := []*EventSink{}
+	for i, config := range configs {
+		if config.Name == "" {
+			config.Name = fmt.Sprintf("%s%d", config.Type, i)
+		}
+		sink, err := NewSink(&config)
+		if err != nil {
+			return nil, fmt.Errorf("event_sinks: %s: %v", config.Name, err)
+		}
+		eventSink := EventSink{
+			sink:      sink,
+			events:    map[string]bool{},
+			onFailure: strings.ToLower(config.OnFailure),
+		}
+		switch eventSink.onFailure {
+		case "":
+			eventSink.onFailure = SinkFailureIgnore
+		case SinkFailureIgnore, SinkFailureDisable, SinkFailureFail:
+		default:
+			return nil, fmt.Errorf("event_sinks: %s: unsupported on_failure: %s", config.Name, config.OnFailure)
+		}
+		for _, name := range config.Events {
+			eventSink.events[strings.ToLower(name)] = true
+		}
+		sinks = append(sinks, &eventSink)
+	}
+	return sinks, nil
+}
+
+// NewSink returns the sink described by a config entry
+func NewSink(config *SinkConfig) (Sink, error) {
+	timeout, err := parseSinkDuration(config.Timeout, 30*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("timeout: %v", err)
+	}
+	switch strings.ToLower(config.Type) {
+	case "syslog":
+		return newSyslogSink(config, timeout)
+	case "exec":
+		if len(config.Command) == 0 {
+			return nil, fmt.Errorf("exec sink requires command")
+		}
+		return &ExecSink{name: config.Name, command: config.Command, timeout: timeout}, nil
+	case "http":
+		if config.URL == "" {
+			return nil, fmt.Errorf("http sink requires url")
+		}
+		delay, err := parseSinkDuration(config.RetryDelay, time.Second)
+		if err != nil {
+			return nil, fmt.Errorf("retry_delay: %v", err)
+		}
+		retries := config.Retries
+		if retries < 0 {
+			return nil, fmt.Errorf("invalid retries: %d", retries)
+		}
+		return &HTTPSink{
+			name:    config.Name,
+			url:     config.URL,
+			headers: config.Headers,
+			retries: retries,
+			delay:   delay,
+			client:  &http.Client{Timeout: timeout},
+		}, nil
+	case "unix":
+		if config.Address == "" {
+			return nil, fmt.Errorf("unix sink requires address")
+		}
+		return &UnixSink{name: config.Name, address: config.Address, timeout: timeout}, nil
+	}
+	return nil, fmt.Errorf("unsupported sink type: %s", config.Type)
+}
+
+func parseSinkDuration(value string, defaultValue time.Duration) (time.Duration, error) {
+	if value == "" {
+		return defaultValue, nil
+	}
+	return time.ParseDuration(value)
+}
+
+// Publish sends an event to the sink if it passes the event type filter,
+// applying the failure policy; an error is returned only by fail sinks, and
+// only by those is the event published again
+func (s *EventSink) Publish(event events.Event, data []byte) error {
+	if len(s.events) > 0 && !s.events[event.GetName()] {
+		return nil
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.disabled {
+		return nil
+	}
+	err := s.sink.Publish(event, data)
+	if err == nil {
+		return nil
+	}
+	log.Printf("sink_failed: %s %s %v\n", s.sink.Name(), event.GetID(), err)
+	switch s.onFailure {
+	case SinkFailureDisable:
+		log.Printf("sink_disabled: %s\n", s.sink.Name())
+		s.disabled = true
+	case SinkFailureFail:
+		return fmt.Errorf("sink %s: %v", s.sink.Name(), err)
+	}
+	return nil
+}
+
+// heldEvent is a received event kept out of the events store until the
+// sinks with the fail policy that did not accept it do so
+type heldEvent struct {
+	event events.Event
+	sinks []*EventSink
+}
+
+// publishEvent sends a new event to sinks, returning the sinks with the fail
+// policy that did not accept it
+func (c *Client) publishEvent(event events.Event, sinks []*EventSink) ([]*EventSink, error) {
+	if len(sinks) == 0 {
+		return nil, nil
+	}
+	data, err := json.Marshal(event)
+	if err != nil {
+		return nil, err
+	}
+	failed := []*EventSink{}
+	for _, sink := range sinks {
+		if sink.Publish(event, data) != nil {
+			failed = append(failed, sink)
+		}
+	}
+	return failed, nil
+}
+
+// retryHeldEvents publishes the held events again to the sinks that did not
+// accept them, storing each event once every such sink has
+func (c *Client) retryHeldEvents() error {
+	ids := []string{}
+	for id := range c.held {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return c.held[ids[i]].event.GetTimestamp().Before(c.held[ids[j]].event.GetTimestamp())
+	})
+	for _, id := range ids {
+		held := c.held[id]
+		failed, err := c.publishEvent(held.event, held.sinks)
+		if err != nil {
+			return err
+		}
+		if len(failed) > 0 {
+			held.sinks = failed
+			continue
+		}
+		delete(c.held, id)
+		err = c.storeEvent(held.event)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var syslogFacilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5,
+	"lpr": 6, "news": 7, "uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19,
+	"local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+// SyslogSink writes each event as an RFC 5424 message to a syslog server
+// over a unix socket, UDP or TCP, using octet counting framing on TCP
+type SyslogSink struct {
+	name     string
+	network  string
+	address  string
+	facility int
+	tag      string
+	hostname string
+	timeout  time.Duration
+}
+
+func newSyslogSink(config *SinkConfig, timeout time.Duration) (*SyslogSink, error) {
+	network := strings.ToLower(config.Network)
+	address := config.Address
+	switch network {
+	case "", "unix":
+		network = "unix"
+		if address == "" {
+			address = "/dev/log"
+		}
+	case "udp", "tcp":
+		if address == "" {
+			return nil, fmt.Errorf("syslog sink requires address for %s", network)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported syslog network: %s", config.Network)
+	}
+	facilityName := strings.ToLower(config.Facility)
+	if facilityName == "" {
+		facilityName = "mail"
+	}
+	facility, ok := syslogFacilities[facilityName]
+	if !ok {
+		return nil, fmt.Errorf("unsupported syslog facility: %s", config.Facility)
+	}
+	tag := config.Tag
+	if tag == "" {
+		tag = "mailgun"
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, err
+	}
+	return &SyslogSink{
+		name:     config.Name,
+		network:  network,
+		address:  address,
+		facility: facility,
+		tag:      tag,
+		hostname: hostname,
+		timeout:  timeout,
+	}, nil
+}
+
+func (s *SyslogSink) Name() string {
+	return s.name
+}
+
+// syslogSeverity returns warning for failures and complaints, otherwise info
+func syslogSeverity(event events.Event) int {
+	switch event.GetName() {
+	case events.EventFailed, events.EventComplained:
+		return 4
+	}
+	return 6
+}
+
+// format returns the RFC 5424 message for an event
+func (s *SyslogSink) format(event events.Event, data []byte) []byte {
+	return []byte(fmt.Sprintf("<%d>1 %s %s %s %d %s - %s",
+		s.facility*8+syslogSeverity(event),
+		time.Now().UTC().Format("2006-01-02T15:04:05.000000Z"),
+		s.hostname, s.tag, os.Getpid(), event.GetName(), data))
+}
+
+func (s *SyslogSink) Publish(event events.Event, data []byte) error {
+	message := s.format(event, data)
+	network := s.network
+	if network == "unix" {
+		network = "unixgram"
+	}
+	conn, err := net.DialTimeout(network, s.address, s.timeout)
+	if err != nil && s.network == "unix" {
+		conn, err = net.DialTimeout("unix", s.address, s.timeout)
+		network = "unix"
+	}
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(s.timeout))
+	switch network {
+	case "tcp":
+		message = append([]byte(fmt.Sprintf("%d ", len(message))), message...)
+	case "unix":
+		message = append(message, '\n')
+	}
+	_, err = conn.Write(message)
+	return err
+}
+
+// ExecSink runs a command for each event with the event JSON on stdin and
+// the event ID and type in MAILGUN_EVENT_ID and MAILGUN_EVENT
+type ExecSink struct {
+	name    string
+	command []string
+	timeout time.Duration
+}
+
+func (s *ExecSink) Name() string {
+	return s.name
+}
+
+func (s *ExecSink) Publish(event events.Event, data []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, s.command[0], s.command[1:]...)
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.Env = append(os.Environ(), "MAILGUN_EVENT="+event.GetName(), "MAILGUN_EVENT_ID="+event.GetID())
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s failed: %v: %s", s.command[0], err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// HTTPSink POSTs the event JSON to a URL, retrying failed requests with a
+// doubling delay
+type HTTPSink struct {
+	name    string
+	url     string
+	headers map[string]string
+	retries int
+	delay   time.Duration
+	client  *http.Client
+}
+
+func (s *HTTPSink) Name() string {
+	return s.name
+}
+
+func (s *HTTPSink) post(data []byte) error {
+	request, err := http.NewRequest(http.MethodPost, s.url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	for key, value := range s.headers {
+		request.Header.Set(key, value)
+	}
+	response, err := s.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("%s: %s", s.url, response.Status)
+	}
+	return nil
+}
+
+func (s *HTTPSink) Publish(event events.Event, data []byte) error {
+	delay := s.delay
+	var err error
+	for attempt := 0; attempt <= s.retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(delay)
+			delay *= 2
+		}
+		err = s.post(data)
+		if err == nil {
+			return nil
+		}
+		if viper.GetBool("verbose") {
+			log.Printf("sink_retry: %s %s attempt %d: %v\n", s.name, event.GetID(), attempt+1, err)
+		}
+	}
+	return err
+}
+
+// UnixSink writes each event as a line of JSON to a unix stream socket
+type UnixSink struct {
+	name    string
+	address string
+	timeout time.Duration
+}
+
+func (s *UnixSink) Name() string {
+	return s.name
+}
+
+func (s *UnixSink) Publish(event events.Event, data []byte) error {
+	conn, err := net.DialTimeout("unix", s.address, s.timeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(s.timeout))
+	_, err = conn.Write(append(data, '\n'))
+	return err
+}
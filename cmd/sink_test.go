@@ -0,0 +1,232 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mailgun/mailgun-go/v5/events"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+)
+
+func loadTestSinks(t *testing.T, configs ...map[string]any) []*EventSink {
+	viper.Set("event_sinks", configs)
+	t.Cleanup(func() { viper.Set("event_sinks", nil) })
+	sinks, err := LoadEventSinks()
+	require.Nil(t, err)
+	return sinks
+}
+
+func TestLoadEventSinks(t *testing.T) {
+	sinks := loadTestSinks(t,
+		map[string]any{"type": "exec", "command": []string{"true"}, "events": []string{"Failed"}},
+		map[string]any{"name": "hook", "type": "http", "url": "http://localhost/", "on_failure": "fail"},
+	)
+	require.Len(t, sinks, 2)
+	require.Equal(t, "exec0", sinks[0].sink.Name())
+	require.True(t, sinks[0].events["failed"])
+	require.Equal(t, SinkFailureIgnore, sinks[0].onFailure)
+	require.Equal(t, "hook", sinks[1].sink.Name())
+	require.Equal(t, SinkFailureFail, sinks[1].onFailure)
+
+	for _, config := range []map[string]any{
+		{"type": "kafka"},
+		{"type": "exec"},
+		{"type": "http"},
+		{"type": "unix"},
+		{"type": "syslog", "network": "tcp"},
+		{"type": "syslog", "facility": "bogus"},
+		{"type": "http", "url": "http://localhost/", "retry_delay": "soon"},
+		{"type": "exec", "command": []string{"true"}, "on_failure": "panic"},
+	} {
+		viper.Set("event_sinks", []map[string]any{config})
+		_, err := LoadEventSinks()
+		require.NotNil(t, err, config)
+	}
+}
+
+func TestSyslogSink(t *testing.T) {
+	event := loadTestEvent(t, "failed.json")
+	data, err := json.Marshal(event)
+	require.Nil(t, err)
+	pattern := regexp.MustCompile(`^<20>1 \S+Z \S+ bouncer \d+ failed - \{.*\}$`)
+
+	udp, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.Nil(t, err)
+	defer udp.Close()
+	sink, err := NewSink(&SinkConfig{Type: "syslog", Network: "udp", Address: udp.LocalAddr().String(), Tag: "bouncer"})
+	require.Nil(t, err)
+	require.Nil(t, sink.Publish(event, data))
+	buf := make([]byte, 65536)
+	udp.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := udp.ReadFrom(buf)
+	require.Nil(t, err)
+	require.Regexp(t, pattern, string(buf[:n]))
+
+	tcp, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	defer tcp.Close()
+	received := make(chan string, 1)
+	go func() {
+		conn, err := tcp.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		reader := bufio.NewReader(conn)
+		var length int
+		fmt.Fscanf(reader, "%d ", &length)
+		message := make([]byte, length)
+		io.ReadFull(reader, message)
+		received <- string(message)
+	}()
+	sink, err = NewSink(&SinkConfig{Type: "syslog", Network: "tcp", Address: tcp.Addr().String(), Tag: "bouncer"})
+	require.Nil(t, err)
+	require.Nil(t, sink.Publish(event, data))
+	select {
+	case message := <-received:
+		require.Regexp(t, pattern, message)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no syslog message received")
+	}
+}
+
+func TestExecSink(t *testing.T) {
+	event := loadTestEvent(t, "failed.json")
+	data, err := json.Marshal(event)
+	require.Nil(t, err)
+	output := filepath.Join(t.TempDir(), "event")
+	sink, err := NewSink(&SinkConfig{Type: "exec", Command: []string{"sh", "-c", `echo "$MAILGUN_EVENT $MAILGUN_EVENT_ID" > ` + output + `; cat >> ` + output}})
+	require.Nil(t, err)
+	require.Nil(t, sink.Publish(event, data))
+	written, err := os.ReadFile(output)
+	require.Nil(t, err)
+	require.Equal(t, "failed "+event.GetID()+"\n"+string(data), string(written))
+
+	sink, err = NewSink(&SinkConfig{Type: "exec", Command: []string{"sh", "-c", "echo broken >&2; exit 1"}})
+	require.Nil(t, err)
+	err = sink.Publish(event, data)
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "broken")
+}
+
+func TestHTTPSink(t *testing.T) {
+	event := loadTestEvent(t, "failed.json")
+	data, err := json.Marshal(event)
+	require.Nil(t, err)
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		if r.Header.Get("Authorization") != "Bearer secret" || string(body) != string(data) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}))
+	defer server.Close()
+
+	config := SinkConfig{Type: "http", URL: server.URL, Headers: map[string]string{"Authorization": "Bearer secret"}, Retries: 1, RetryDelay: "1ms"}
+	sink, err := NewSink(&config)
+	require.Nil(t, err)
+	require.NotNil(t, sink.Publish(event, data))
+	require.Equal(t, int32(2), requests.Load())
+
+	requests.Store(0)
+	config.Retries = 2
+	sink, err = NewSink(&config)
+	require.Nil(t, err)
+	require.Nil(t, sink.Publish(event, data))
+	require.Equal(t, int32(3), requests.Load())
+}
+
+func TestUnixSink(t *testing.T) {
+	event := loadTestEvent(t, "failed.json")
+	data, err := json.Marshal(event)
+	require.Nil(t, err)
+	dir, err := os.MkdirTemp("", "sink")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	address := filepath.Join(dir, "events.sock")
+	listener, err := net.Listen("unix", address)
+	require.Nil(t, err)
+	defer listener.Close()
+	received := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		line, _ := bufio.NewReader(conn).ReadString('\n')
+		received <- line
+	}()
+	sink, err := NewSink(&SinkConfig{Type: "unix", Address: address})
+	require.Nil(t, err)
+	require.Nil(t, sink.Publish(event, data))
+	select {
+	case line := <-received:
+		require.Equal(t, string(data)+"\n", line)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event received")
+	}
+}
+
+func TestSinkPolicies(t *testing.T) {
+	api, _ := newTestClient(t)
+	dir := t.TempDir()
+	record := filepath.Join(dir, "published")
+	api.sinks = loadTestSinks(t,
+		map[string]any{"type": "exec", "command": []string{"sh", "-c", "echo $MAILGUN_EVENT_ID >> " + record}, "events": []string{"complained"}},
+		map[string]any{"type": "exec", "command": []string{"false"}, "on_failure": "disable"},
+		map[string]any{"type": "exec", "command": []string{"sh", "-c", "test ! -e " + filepath.Join(dir, "broken")}, "on_failure": "fail"},
+	)
+
+	complaint := loadTestEvent(t, "complained.json")
+	require.Nil(t, api.receiveEvent(complaint))
+	require.True(t, api.edb.Has(complaint.GetID()))
+	require.True(t, api.sinks[1].disabled)
+
+	// a failing sink with the fail policy holds the event until it accepts
+	// it, without publishing it again to the other sinks
+	require.Nil(t, os.WriteFile(filepath.Join(dir, "broken"), []byte{}, 0600))
+	held := loadTestEvent(t, "complained.json").(*events.Complained)
+	held.ID = "held-1"
+	require.Nil(t, api.receiveEvent(held))
+	require.False(t, api.edb.Has(held.GetID()))
+	require.Contains(t, api.held, held.GetID())
+	require.Nil(t, api.receiveEvent(held))
+	require.Nil(t, api.retryHeldEvents())
+	require.False(t, api.edb.Has(held.GetID()))
+
+	require.Nil(t, os.Remove(filepath.Join(dir, "broken")))
+	require.Nil(t, api.retryHeldEvents())
+	require.True(t, api.edb.Has(held.GetID()))
+	require.Empty(t, api.held)
+
+	// duplicates are not published again
+	require.Nil(t, api.receiveEvent(complaint))
+
+	// events stored by the query commands are not published
+	queried := loadTestEvent(t, "complained.json").(*events.Complained)
+	queried.ID = "queried-1"
+	require.Nil(t, api.storeEvent(queried))
+	require.True(t, api.edb.Has(queried.GetID()))
+	published, err := os.ReadFile(record)
+	require.Nil(t, err)
+	require.Equal(t, []string{complaint.GetID(), held.GetID()}, strings.Fields(string(published)))
+}
@@ -0,0 +1,257 @@
+package cmd
+
+import (
+	"fmt"
+	"math"
+	"net/mail"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mailgun/mailgun-go/v5/events"
+)
+
+// stats breakdowns
+const (
+	StatsSender   = "sender"
+	StatsDomain   = "domain"
+	StatsTag      = "tag"
+	StatsPeriod   = "period"
+	StatsCategory = "category"
+)
+
+var statsBreakdowns = []string{StatsSender, StatsDomain, StatsTag, StatsPeriod, StatsCategory}
+
+// stats periods
+const (
+	StatsHour = "hour"
+	StatsDay  = "day"
+)
+
+// StatsCounts are the event counts of a stats group; failed counts permanent
+// failures and deferred counts temporary failures
+type StatsCounts struct {
+	Accepted        int     `json:"accepted"`
+	Delivered       int     `json:"delivered"`
+	Failed          int     `json:"failed"`
+	Deferred        int     `json:"deferred"`
+	Complained      int     `json:"complained"`
+	Unsubscribed    int     `json:"unsubscribed"`
+	DeliveryRate    float64 `json:"delivery_rate"`
+	FailureRate     float64 `json:"failure_rate"`
+	ComplaintRate   float64 `json:"complaint_rate"`
+	UnsubscribeRate float64 `json:"unsubscribe_rate"`
+}
+
+// StatsGroup is the counts of the events sharing a breakdown key
+type StatsGroup struct {
+	Key string `json:"key"`
+	StatsCounts
+}
+
+// StatsRecord is a group of a breakdown, or the total, as written by the
+// structured output formats
+type StatsRecord struct {
+	Breakdown string `json:"breakdown"`
+	StatsGroup
+}
+
+// Stats is a delivery statistics report over the events in a time window
+type Stats struct {
+	Begin      time.Time               `json:"begin"`
+	End        time.Time               `json:"end"`
+	Period     string                  `json:"period"`
+	Events     int                     `json:"events"`
+	Total      StatsCounts             `json:"total"`
+	Breakdowns map[string][]StatsGroup `json:"breakdowns"`
+}
+
+// add counts an event, returning false for event types that are not counted
+func (s *StatsCounts) add(event events.Event) bool {
+	switch event := event.(type) {
+	case *events.Accepted:
+		s.Accepted++
+	case *events.Delivered:
+		s.Delivered++
+	case *events.Failed:
+		if event.Severity == "temporary" {
+			s.Deferred++
+		} else {
+			s.Failed++
+		}
+	case *events.Complained:
+		s.Complained++
+	case *events.Unsubscribed:
+		s.Unsubscribed++
+	default:
+		return false
+	}
+	return true
+}
+
+func statsRate(count, base int) float64 {
+	if base == 0 {
+		return 0
+	}
+	return math.Round(float64(count)/float64(base)*10000) / 10000
+}
+
+// rates sets the delivery and failure rates relative to the accepted
+// messages, or to the delivery attempts when no accepted events were
+// stored, and the complaint and unsubscribe rates relative to the delivered
+// messages
+func (s *StatsCounts) rates() {
+	base := s.Accepted
+	if base == 0 {
+		base = s.Delivered + s.Failed
+	}
+	s.DeliveryRate = statsRate(s.Delivered, base)
+	s.FailureRate = statsRate(s.Failed, base)
+	s.ComplaintRate = statsRate(s.Complained, s.Delivered)
+	s.UnsubscribeRate = statsRate(s.Unsubscribed, s.Delivered)
+}
+
+func (s *StatsCounts) total() int {
+	return s.Accepted + s.Delivered + s.Failed + s.Deferred + s.Complained + s.Unsubscribed
+}
+
+// statsKeys returns the breakdown keys of an event
+func (c *Client) statsKeys(event events.Event, fields *eventFields, period string) map[string][]string {
+	sender := fields.Envelope.Sender
+	if sender == "" {
+		address, err := mail.ParseAddress(fields.Message.Headers.From)
+		if err == nil {
+			sender = address.Address
+		}
+	}
+	domain := ""
+	if _, after, found := strings.Cut(fields.Recipient, "@"); found {
+		domain = after
+	}
+	layout := "2006-01-02"
+	if period == StatsHour {
+		layout = "2006-01-02T15"
+	}
+	keys := map[string][]string{
+		StatsSender: {strings.ToLower(sender)},
+		StatsDomain: {strings.ToLower(domain)},
+		StatsTag:    fields.Tags,
+		StatsPeriod: {event.GetTimestamp().UTC().Format(layout)},
+	}
+	if failed, ok := event.(*events.Failed); ok && failed.Severity != "temporary" {
+		keys[StatsCategory] = []string{c.classifier.Classify(failed)}
+	}
+	return keys
+}
+
+// EventStats counts the stored events passing the filter, in total and by
+// sender, recipient domain, tag, hour or day, and bounce category of the
+// permanent failures; top limits each breakdown to its largest groups
+func (c *Client) EventStats(filter *EventFilter, period string, top int) (*Stats, error) {
+	if period != StatsHour && period != StatsDay {
+		return nil, fmt.Errorf("unsupported period: %s", period)
+	}
+	selected, err := c.LocalEvents(&EventFilter{
+		Begin:     filter.Begin,
+		End:       filter.End,
+		Event:     filter.Event,
+		Recipient: filter.Recipient,
+		From:      filter.From,
+		Tag:       filter.Tag,
+		Severity:  filter.Severity,
+		MessageID: filter.MessageID,
+		Ascending: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	stats := Stats{
+		Begin:      filter.Begin,
+		End:        filter.End,
+		Period:     period,
+		Breakdowns: map[string][]StatsGroup{},
+	}
+	groups := map[string]map[string]*StatsCounts{}
+	for _, name := range statsBreakdowns {
+		groups[name] = map[string]*StatsCounts{}
+	}
+	for _, event := range *selected {
+		if !stats.Total.add(event) {
+			continue
+		}
+		stats.Events++
+		timestamp := event.GetTimestamp()
+		if filter.Begin.IsZero() && (stats.Begin.IsZero() || timestamp.Before(stats.Begin)) {
+			stats.Begin = timestamp
+		}
+		if filter.End.IsZero() && timestamp.After(stats.End) {
+			stats.End = timestamp
+		}
+		fields, err := fieldsOf(event)
+		if err != nil {
+			return nil, err
+		}
+		for name, keys := range c.statsKeys(event, fields, period) {
+			for _, key := range keys {
+				if key == "" {
+					continue
+				}
+				counts, ok := groups[name][key]
+				if !ok {
+					counts = &StatsCounts{}
+					groups[name][key] = counts
+				}
+				counts.add(event)
+			}
+		}
+	}
+	stats.Total.rates()
+	for name, counts := range groups {
+		list := []StatsGroup{}
+		for key, group := range counts {
+			group.rates()
+			list = append(list, StatsGroup{Key: key, StatsCounts: *group})
+		}
+		sort.Slice(list, func(i, j int) bool {
+			if name != StatsPeriod && list[i].total() != list[j].total() {
+				return list[i].total() > list[j].total()
+			}
+			return list[i].Key < list[j].Key
+		})
+		if top > 0 && name != StatsPeriod && len(list) > top {
+			list = list[:top]
+		}
+		stats.Breakdowns[name] = list
+	}
+	return &stats, nil
+}
+
+var statsColumns = []string{"breakdown", "key", "accepted", "delivered", "failed", "deferred", "complained", "unsubscribed", "delivery_rate", "failure_rate", "complaint_rate", "unsubscribe_rate"}
+
+// statsRow returns the column values for the counts of a group, with the
+// key also under the breakdown name and the rates as percentages when
+// percent is set
+func statsRow(breakdown, key string, counts *StatsCounts, percent bool) map[string]string {
+	rate := func(value float64) string {
+		if percent {
+			return strconv.FormatFloat(value*100, 'f', 1, 64) + "%"
+		}
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	}
+	return map[string]string{
+		"breakdown":        breakdown,
+		"key":              key,
+		breakdown:          key,
+		"accepted":         strconv.Itoa(counts.Accepted),
+		"delivered":        strconv.Itoa(counts.Delivered),
+		"failed":           strconv.Itoa(counts.Failed),
+		"deferred":         strconv.Itoa(counts.Deferred),
+		"complained":       strconv.Itoa(counts.Complained),
+		"unsubscribed":     strconv.Itoa(counts.Unsubscribed),
+		"delivery_rate":    rate(counts.DeliveryRate),
+		"failure_rate":     rate(counts.FailureRate),
+		"complaint_rate":   rate(counts.ComplaintRate),
+		"unsubscribe_rate": rate(counts.UnsubscribeRate),
+	}
+}
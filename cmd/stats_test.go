@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mailgun/mailgun-go/v5/events"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventStats(t *testing.T) {
+	api, _ := newTestClient(t)
+	failed := loadTestEvent(t, "failed.json").(*events.Failed)
+	generic := func(name, id string, offset float64) events.Generic {
+		return events.Generic{EventName: events.EventName{Name: name}, ID: id, Timestamp: failed.Timestamp + offset}
+	}
+	envelope := events.Envelope{Sender: "alice@example.com"}
+	stored := []events.Event{
+		failed,
+		failedVariant(t, "deferred-1", "temporary"),
+		&events.Accepted{Generic: generic(events.EventAccepted, "accepted-1", -10), Envelope: envelope, Recipient: "nobody@example.org", Tags: []string{"newsletter"}},
+		&events.Accepted{Generic: generic(events.EventAccepted, "accepted-2", -10), Envelope: envelope, Recipient: "bob@example.net"},
+		&events.Accepted{Generic: generic(events.EventAccepted, "accepted-3", 3600), Envelope: envelope, Recipient: "eve@example.net"},
+		&events.Delivered{Generic: generic(events.EventDelivered, "delivered-1", 5), Envelope: envelope, Recipient: "bob@example.net"},
+		&events.Delivered{Generic: generic(events.EventDelivered, "delivered-2", 3605), Envelope: envelope, Recipient: "eve@example.net"},
+		&events.Opened{Generic: generic(events.EventOpened, "opened-1", 60), Recipient: "bob@example.net"},
+		&events.Unsubscribed{Generic: generic(events.EventUnsubscribed, "unsubscribed-1", 3660), Recipient: "eve@example.net"},
+	}
+	for _, event := range stored {
+		require.Nil(t, api.storeEvent(event))
+	}
+
+	stats, err := api.EventStats(&EventFilter{}, StatsHour, 0)
+	require.Nil(t, err)
+	require.Equal(t, 8, stats.Events)
+	require.Equal(t, failed.GetTimestamp().Add(-10*time.Second), stats.Begin)
+	total := stats.Total
+	require.Equal(t, []int{3, 2, 1, 1, 0, 1}, []int{total.Accepted, total.Delivered, total.Failed, total.Deferred, total.Complained, total.Unsubscribed})
+	require.Equal(t, 0.6667, total.DeliveryRate)
+	require.Equal(t, 0.3333, total.FailureRate)
+	require.Equal(t, 0.5, total.UnsubscribeRate)
+
+	keys := func(name string) []string {
+		keys := []string{}
+		for _, group := range stats.Breakdowns[name] {
+			keys = append(keys, group.Key)
+		}
+		return keys
+	}
+	require.Equal(t, []string{"example.net", "example.org"}, keys(StatsDomain))
+	require.Equal(t, []string{"alice@example.com"}, keys(StatsSender))
+	require.Equal(t, []string{"newsletter"}, keys(StatsTag))
+	require.Equal(t, []string{"2025-10-16T11", "2025-10-16T12", "2025-10-16T13"}, keys(StatsPeriod))
+	require.Equal(t, []string{api.classifier.Classify(failed)}, keys(StatsCategory))
+	domain := stats.Breakdowns[StatsDomain][1].StatsCounts
+	require.Equal(t, []int{1, 1, 1}, []int{domain.Accepted, domain.Failed, domain.Deferred})
+	require.Equal(t, 1.0, domain.FailureRate)
+
+	stats, err = api.EventStats(&EventFilter{Begin: failed.GetTimestamp().Add(time.Minute)}, StatsDay, 1)
+	require.Nil(t, err)
+	require.Equal(t, 3, stats.Events)
+	require.Equal(t, []string{"2025-10-16"}, keys(StatsPeriod))
+	require.Equal(t, []string{"example.net"}, keys(StatsDomain))
+
+	_, err = api.EventStats(&EventFilter{}, "week", 0)
+	require.NotNil(t, err)
+
+	var buf bytes.Buffer
+	output, err := NewOutput(&buf, OutputCSV, statsColumns, false)
+	require.Nil(t, err)
+	require.Nil(t, output.Write(nil, statsRow("total", "all", &stats.Total, false)))
+	require.Nil(t, output.Close())
+	require.Equal(t, []string{
+		"breakdown,key,accepted,delivered,failed,deferred,complained,unsubscribed,delivery_rate,failure_rate,complaint_rate,unsubscribe_rate",
+		"total,all,1,1,0,0,0,1,1,0,0,1",
+	}, strings.Split(strings.TrimSpace(buf.String()), "\n"))
+}
@@ -0,0 +1,157 @@
+/*
+Copyright © 2025 Matt Krueger <mkrueger@rstms.net>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+ 1. Redistributions of source code must retain the above copyright notice,
+    this list of conditions and the following disclaimer.
+
+ 2. Redistributions in binary form must reproduce the above copyright notice,
+    this list of conditions and the following disclaimer in the documentation
+    and/or other materials provided with the distribution.
+
+ 3. Neither the name of the copyright holder nor the names of its contributors
+    may be used to endorse or promote products derived from this software
+    without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+POSSIBILITY OF SUCH DAMAGE.
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var statsBegin string
+var statsEnd string
+var statsPeriod string
+var statsTop int
+var statsFilter EventFilter
+
+var statsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "report delivery statistics",
+	Long: `
+Report delivery statistics computed from the local events store, without
+querying the mailgun API.
+
+The accepted, delivered, failed (permanent), deferred (temporary failure),
+complained and unsubscribed events are counted in total and by sender,
+recipient domain, tag, hour or day (--period), and bounce category of the
+permanent failures.  Delivery and failure rates are relative to the
+accepted messages, or to the delivery attempts when no accepted events
+were stored; complaint and unsubscribe rates are relative to the delivered
+messages.  --top limits each breakdown except the periods to its largest
+groups.
+
+--begin and --end select the time window as for the events command, and
+the other filter flags restrict the events counted.
+
+By default the report is written as text tables; json output holds the
+whole report and the other formats write a row for the total and for each
+group.
+`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		now := time.Now()
+		filter := statsFilter
+		var err error
+		filter.Begin, err = ParseEventTime(statsBegin, now)
+		if err != nil {
+			cobra.CheckErr(fmt.Errorf("begin: %v", err))
+		}
+		filter.End, err = ParseEventTime(statsEnd, now)
+		if err != nil {
+			cobra.CheckErr(fmt.Errorf("end: %v", err))
+		}
+		api := NewClient()
+		stats, err := api.EventStats(&filter, strings.ToLower(statsPeriod), statsTop)
+		cobra.CheckErr(err)
+		format := OutputFormat(OutputText)
+		switch format {
+		case OutputText:
+			cobra.CheckErr(writeStatsText(stats))
+			return
+		case OutputJSON:
+			fmt.Println(FormatJSON(stats))
+			return
+		}
+		output, err := NewOutput(os.Stdout, format, statsColumns, false)
+		cobra.CheckErr(err)
+		records := []StatsRecord{{Breakdown: "total", StatsGroup: StatsGroup{Key: "all", StatsCounts: stats.Total}}}
+		for _, name := range statsBreakdowns {
+			for _, group := range stats.Breakdowns[name] {
+				records = append(records, StatsRecord{Breakdown: name, StatsGroup: group})
+			}
+		}
+		for _, record := range records {
+			cobra.CheckErr(output.Write(record, statsRow(record.Breakdown, record.Key, &record.StatsCounts, false)))
+		}
+		cobra.CheckErr(output.Close())
+	},
+}
+
+// writeStatsText writes the report window and a table for the total and
+// each breakdown
+func writeStatsText(stats *Stats) error {
+	window := "no events"
+	if !stats.Begin.IsZero() {
+		window = stats.Begin.Format(time.RFC3339) + " to " + stats.End.Format(time.RFC3339)
+	}
+	fmt.Printf("%d events, %s\n", stats.Events, window)
+	counts := []string{"accepted", "delivered", "failed", "deferred", "complained", "unsubscribed", "delivery", "failure", "complaint", "unsubscribe"}
+	row := func(name, key string, counts *StatsCounts) map[string]string {
+		row := statsRow(name, key, counts, true)
+		for _, rate := range []string{"delivery", "failure", "complaint", "unsubscribe"} {
+			row[rate] = row[rate+"_rate"]
+		}
+		return row
+	}
+	sections := append([]string{"total"}, statsBreakdowns...)
+	for _, name := range sections {
+		table := Table{Columns: append([]string{name}, counts...), Width: terminalWidth()}
+		if name == "total" {
+			table.Rows = append(table.Rows, row(name, "all", &stats.Total))
+		}
+		for _, group := range stats.Breakdowns[name] {
+			table.Rows = append(table.Rows, row(name, group.Key, &group.StatsCounts))
+		}
+		if len(table.Rows) == 0 {
+			continue
+		}
+		fmt.Println()
+		err := table.Write(os.Stdout)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(statsCmd)
+	statsCmd.Flags().StringVarP(&statsBegin, "begin", "b", "", "earliest event time")
+	statsCmd.Flags().StringVarP(&statsEnd, "end", "e", "", "latest event time")
+	statsCmd.Flags().StringVarP(&statsPeriod, "period", "p", StatsDay, "period breakdown: hour or day")
+	statsCmd.Flags().IntVarP(&statsTop, "top", "T", 10, "largest groups shown per breakdown, 0 for all")
+	statsCmd.Flags().StringVarP(&statsFilter.Recipient, "recipient", "r", "", "recipient address")
+	statsCmd.Flags().StringVarP(&statsFilter.From, "from", "f", "", "From header address")
+	statsCmd.Flags().StringVarP(&statsFilter.Tag, "tag", "t", "", "message tag")
+}
@@ -0,0 +1,168 @@
+package cmd
+
+import (
+	"context"
+	"log"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mailgun/mailgun-go/v5"
+	"github.com/spf13/viper"
+)
+
+// Supervisor runs an event poller for each monitored domain, restarting
+// pollers that fail and, when discovering domains, starting and stopping
+// pollers as domains are added to or removed from the mailgun account
+type Supervisor struct {
+	domains  []string
+	discover func() ([]string, error)
+	run      func(ctx context.Context, domain string) error
+	interval time.Duration
+	restart  time.Duration
+	lock     sync.Mutex
+	pollers  map[string]context.CancelFunc
+	wait     sync.WaitGroup
+}
+
+func initSupervisorConfig() {
+	viper.SetDefault("domain_discovery_interval", "10m")
+	viper.SetDefault("monitor_restart_delay", "1m")
+}
+
+// NewSupervisor returns a supervisor for the listed domains, or for every
+// active domain of the account when domains is empty
+func NewSupervisor(domains []string) (*Supervisor, error) {
+	interval, err := time.ParseDuration(viper.GetString("domain_discovery_interval"))
+	if err != nil {
+		return nil, err
+	}
+	restart, err := time.ParseDuration(viper.GetString("monitor_restart_delay"))
+	if err != nil {
+		return nil, err
+	}
+	s := Supervisor{
+		domains:  domains,
+		run:      runDomainMonitor,
+		interval: interval,
+		restart:  restart,
+		pollers:  map[string]context.CancelFunc{},
+	}
+	if len(domains) == 0 {
+		// discovery only lists the account domains, so it uses a client
+		// without stores
+		timeout := time.Second * time.Duration(viper.GetInt("api_query_timeout"))
+		client := &Client{api: mailgun.NewMailgun(viper.GetString("api_key"))}
+		s.discover = func() ([]string, error) {
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			return client.listDomains(ctx)
+		}
+	}
+	return &s, nil
+}
+
+// domainDataRoot returns the directory holding the stores of a domain
+// monitored by the supervisor
+func domainDataRoot(domain string) string {
+	return filepath.Join(viper.GetString("data_root"), strings.ToLower(domain))
+}
+
+// runDomainMonitor polls events for one domain using its own stores
+func runDomainMonitor(ctx context.Context, domain string) error {
+	_, err := LoadBounceIdentity(domain)
+	if err != nil {
+		return err
+	}
+	return NewDomainClient(domain, domainDataRoot(domain)).monitorEvents(ctx)
+}
+
+// Run starts the pollers and supervises them until ctx is cancelled
+func (s *Supervisor) Run(ctx context.Context) {
+	s.update(ctx)
+	if s.discover != nil {
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+	loop:
+		for {
+			select {
+			case <-ctx.Done():
+				break loop
+			case <-ticker.C:
+				s.update(ctx)
+			}
+		}
+	} else {
+		<-ctx.Done()
+	}
+	s.wait.Wait()
+}
+
+// Domains returns the domains with a running poller
+func (s *Supervisor) Domains() []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	domains := []string{}
+	for domain := range s.pollers {
+		domains = append(domains, domain)
+	}
+	sort.Strings(domains)
+	return domains
+}
+
+// update starts pollers for new domains and stops pollers for domains that
+// are no longer active; a failed discovery leaves the pollers unchanged
+func (s *Supervisor) update(ctx context.Context) {
+	domains := s.domains
+	if s.discover != nil {
+		discovered, err := s.discover()
+		if err != nil {
+			log.Printf("supervisor: domain discovery failed: %v\n", err)
+			return
+		}
+		domains = discovered
+	}
+	active := map[string]bool{}
+	for _, domain := range domains {
+		active[strings.ToLower(domain)] = true
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for domain, cancel := range s.pollers {
+		if !active[domain] {
+			log.Printf("supervisor: stopping %s\n", domain)
+			cancel()
+			delete(s.pollers, domain)
+		}
+	}
+	for domain := range active {
+		if _, ok := s.pollers[domain]; ok {
+			continue
+		}
+		log.Printf("supervisor: starting %s\n", domain)
+		pollerCtx, cancel := context.WithCancel(ctx)
+		s.pollers[domain] = cancel
+		s.wait.Add(1)
+		go s.supervise(pollerCtx, domain)
+	}
+}
+
+// supervise runs the poller for a domain, restarting it after a delay when
+// it fails
+func (s *Supervisor) supervise(ctx context.Context, domain string) {
+	defer s.wait.Done()
+	for {
+		err := s.run(ctx, domain)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("supervisor: %s failed: %v; restarting in %s\n", domain, err, s.restart)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(s.restart):
+		}
+	}
+}
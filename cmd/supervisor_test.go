@@ -0,0 +1,147 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSupervisor(t *testing.T) {
+	var mutex sync.Mutex
+	discovered := []string{"example.com", "Example.org"}
+	runs := map[string]int{}
+	supervisor := Supervisor{
+		discover: func() ([]string, error) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			if discovered == nil {
+				return nil, fmt.Errorf("api unavailable")
+			}
+			return discovered, nil
+		},
+		run: func(ctx context.Context, domain string) error {
+			mutex.Lock()
+			runs[domain]++
+			count := runs[domain]
+			mutex.Unlock()
+			if domain == "example.com" && count == 1 {
+				return fmt.Errorf("poll failed")
+			}
+			<-ctx.Done()
+			return nil
+		},
+		interval: 20 * time.Millisecond,
+		restart:  10 * time.Millisecond,
+		pollers:  map[string]context.CancelFunc{},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		supervisor.Run(ctx)
+		close(done)
+	}()
+
+	waitFor := func(expected []string) {
+		require.Eventually(t, func() bool {
+			return fmt.Sprint(supervisor.Domains()) == fmt.Sprint(expected)
+		}, time.Second, 5*time.Millisecond)
+	}
+	waitFor([]string{"example.com", "example.org"})
+
+	// the failed poller is restarted
+	require.Eventually(t, func() bool {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return runs["example.com"] == 2
+	}, time.Second, 5*time.Millisecond)
+
+	// a failed discovery keeps the running pollers
+	mutex.Lock()
+	discovered = nil
+	mutex.Unlock()
+	time.Sleep(50 * time.Millisecond)
+	require.Equal(t, []string{"example.com", "example.org"}, supervisor.Domains())
+
+	// added domains are started and removed domains are stopped
+	mutex.Lock()
+	discovered = []string{"example.org", "example.net"}
+	mutex.Unlock()
+	waitFor([]string{"example.net", "example.org"})
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("supervisor did not stop")
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	require.Equal(t, 1, runs["example.org"])
+	require.Equal(t, 1, runs["example.net"])
+}
+
+func TestSupervisorDomainList(t *testing.T) {
+	initTestConfig()
+	supervisor, err := NewSupervisor([]string{"example.com", "example.org"})
+	require.Nil(t, err)
+	require.Nil(t, supervisor.discover)
+	started := make(chan string, 2)
+	supervisor.run = func(ctx context.Context, domain string) error {
+		started <- domain
+		<-ctx.Done()
+		return nil
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-started
+		<-started
+		cancel()
+	}()
+	supervisor.Run(ctx)
+	require.Empty(t, started)
+}
+
+func TestDomainClientStores(t *testing.T) {
+	initTestConfig()
+	root := t.TempDir()
+	viper.Set("data_root", root)
+	defer viper.Set("data_root", "testdata/db")
+	client := NewDomainClient("Example.org", domainDataRoot("Example.org"))
+	require.Equal(t, "Example.org", client.domain)
+	require.Equal(t, filepath.Join(root, "example.org", "mailgun.events"), client.edb.path)
+}
+
+func TestSupervisorDiscoverUnlocked(t *testing.T) {
+	var supervisor *Supervisor
+	supervisor = &Supervisor{
+		discover: func() ([]string, error) {
+			// the supervisor lock is free while the account is queried
+			return append(supervisor.Domains(), "example.com"), nil
+		},
+		run: func(ctx context.Context, domain string) error {
+			<-ctx.Done()
+			return nil
+		},
+		pollers: map[string]context.CancelFunc{},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan bool)
+	go func() {
+		supervisor.update(ctx)
+		done <- true
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("discovery blocked on the supervisor lock")
+	}
+	require.Equal(t, []string{"example.com"}, supervisor.Domains())
+	cancel()
+	supervisor.wait.Wait()
+}
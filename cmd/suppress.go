@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/emersion/go-message/textproto"
+	"github.com/mailgun/mailgun-go/v5/events"
+	"github.com/spf13/viper"
+)
+
+var defaultSuppressLocals = []string{
+	"mailer-daemon",
+	"postmaster",
+	"noreply",
+	"no-reply",
+	"donotreply",
+	"do-not-reply",
+}
+
+// suppressReason applies the RFC 3834 and RFC 5321 loop prevention rules,
+// returning why no bounce may be sent for the event or an empty string.
+// Header based rules are only applied when the original message is available.
+func (c *Client) suppressReason(event *events.Failed, original []byte) string {
+	reason := senderSuppressReason(event.Envelope.Sender)
+	if reason != "" {
+		return reason
+	}
+
+	if original == nil {
+		return ""
+	}
+	header, err := textproto.ReadHeader(bufio.NewReader(bytes.NewReader(original)))
+	if err != nil {
+		return ""
+	}
+	autoSubmitted := strings.ToLower(strings.TrimSpace(header.Get("Auto-Submitted")))
+	if autoSubmitted != "" && autoSubmitted != "no" {
+		return fmt.Sprintf("auto-submitted %s", autoSubmitted)
+	}
+	precedence := strings.ToLower(strings.TrimSpace(header.Get("Precedence")))
+	switch precedence {
+	case "bulk", "list", "junk":
+		return fmt.Sprintf("precedence %s", precedence)
+	}
+	contentType := strings.ToLower(header.Get("Content-Type"))
+	if strings.HasPrefix(contentType, "multipart/report") && strings.Contains(contentType, "delivery-status") {
+		return "message is a delivery status notification"
+	}
+	return ""
+}
+
+// senderSuppressReason returns why no automated reply may be sent to a
+// sender address, or an empty string
+func senderSuppressReason(sender string) string {
+	sender = strings.TrimSpace(strings.Trim(sender, "<>"))
+	if sender == "" {
+		return "null sender"
+	}
+	local, _, _ := strings.Cut(sender, "@")
+	for _, suppressed := range viper.GetStringSlice("suppress_sender_locals") {
+		if strings.EqualFold(local, suppressed) {
+			return fmt.Sprintf("sender local part %s", strings.ToLower(local))
+		}
+	}
+	return ""
+}
@@ -0,0 +1,166 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/term"
+)
+
+// columns narrower than this are not shrunk to fit the terminal
+const minColumnWidth = 6
+
+const columnGap = "  "
+
+// Table writes rows of named columns as aligned text, truncating the widest
+// columns when the rows would not fit in Width
+type Table struct {
+	Columns  []string
+	Rows     []map[string]string
+	NoHeader bool
+	Width    int
+	widths   []int
+	started  bool
+}
+
+// SelectColumns returns the columns named in a comma separated list, or the
+// defaults when the list is empty
+func SelectColumns(spec string, available, defaults []string) ([]string, error) {
+	if strings.TrimSpace(spec) == "" {
+		return defaults, nil
+	}
+	columns := []string{}
+	for _, name := range strings.Split(spec, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		found := false
+		for _, column := range available {
+			if name == column {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown column '%s'; columns are: %s", name, strings.Join(available, ","))
+		}
+		columns = append(columns, name)
+	}
+	return columns, nil
+}
+
+// terminalWidth returns the width of the terminal on stdout, the COLUMNS
+// environment variable when set, or 0 when output is not a terminal
+func terminalWidth() int {
+	columns, err := strconv.Atoi(os.Getenv("COLUMNS"))
+	if err == nil && columns > 0 {
+		return columns
+	}
+	fd := int(os.Stdout.Fd())
+	if !term.IsTerminal(fd) {
+		return 0
+	}
+	width, _, err := term.GetSize(fd)
+	if err != nil {
+		return 0
+	}
+	return width
+}
+
+// columnWidths returns the natural width of each column, shrinking the
+// widest columns until the table fits in the table width
+func (t *Table) columnWidths() []int {
+	widths := make([]int, len(t.Columns))
+	for i, column := range t.Columns {
+		if !t.NoHeader {
+			widths[i] = utf8.RuneCountInString(column)
+		}
+		for _, row := range t.Rows {
+			widths[i] = max(widths[i], utf8.RuneCountInString(row[column]))
+		}
+	}
+	if t.Width <= 0 {
+		return widths
+	}
+	total := len(columnGap) * (len(widths) - 1)
+	for _, width := range widths {
+		total += width
+	}
+	for total > t.Width {
+		widest := -1
+		for i, width := range widths {
+			if width > minColumnWidth && (widest < 0 || width > widths[widest]) {
+				widest = i
+			}
+		}
+		if widest < 0 {
+			break
+		}
+		widths[widest]--
+		total--
+	}
+	return widths
+}
+
+// truncate shortens a value to width runes, marking the cut with "~"
+func truncate(value string, width int) string {
+	if utf8.RuneCountInString(value) <= width {
+		return value
+	}
+	if width < 1 {
+		return ""
+	}
+	runes := []rune(value)
+	return string(runes[:width-1]) + "~"
+}
+
+// Write outputs the header and rows
+func (t *Table) Write(w io.Writer) error {
+	return t.write(w, t.columnWidths(), !t.NoHeader)
+}
+
+// Append outputs the rows added since the last Append and removes them from
+// the table; the header and column widths are those of the first Append,
+// with columns empty in the first rows given the minimum column width
+func (t *Table) Append(w io.Writer) error {
+	if t.widths == nil {
+		t.widths = t.columnWidths()
+		for i := range t.widths {
+			t.widths[i] = max(t.widths[i], minColumnWidth)
+		}
+	}
+	err := t.write(w, t.widths, !t.NoHeader && !t.started)
+	t.started = true
+	t.Rows = nil
+	return err
+}
+
+func (t *Table) write(w io.Writer, widths []int, header bool) error {
+	writeRow := func(value func(string) string) error {
+		fields := make([]string, len(t.Columns))
+		for i, column := range t.Columns {
+			field := truncate(value(column), widths[i])
+			if i < len(t.Columns)-1 {
+				field += strings.Repeat(" ", widths[i]-utf8.RuneCountInString(field))
+			}
+			fields[i] = field
+		}
+		_, err := fmt.Fprintln(w, strings.Join(fields, columnGap))
+		return err
+	}
+	if header {
+		err := writeRow(strings.ToUpper)
+		if err != nil {
+			return err
+		}
+	}
+	for _, row := range t.Rows {
+		err := writeRow(func(column string) string { return row[column] })
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
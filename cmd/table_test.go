@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/mailgun/mailgun-go/v5/mtypes"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSelectColumns(t *testing.T) {
+	columns, err := SelectColumns("", eventColumns, eventColumns)
+	require.Nil(t, err)
+	require.Equal(t, eventColumns, columns)
+	columns, err = SelectColumns("ID, Event", eventColumns, eventColumns)
+	require.Nil(t, err)
+	require.Equal(t, []string{"id", "event"}, columns)
+	_, err = SelectColumns("id,size", eventColumns, eventColumns)
+	require.NotNil(t, err)
+}
+
+func TestTable(t *testing.T) {
+	table := Table{
+		Columns: []string{"address", "code", "error"},
+		Rows: []map[string]string{
+			{"address": "nobody@example.org", "code": "550", "error": "5.1.1 The email account that you tried to reach does not exist"},
+			{"address": "full@example.org", "code": "452", "error": "mailbox full"},
+		},
+	}
+	var buf bytes.Buffer
+	require.Nil(t, table.Write(&buf))
+	require.Equal(t, ""+
+		"ADDRESS             CODE  ERROR\n"+
+		"nobody@example.org  550   5.1.1 The email account that you tried to reach does not exist\n"+
+		"full@example.org    452   mailbox full\n", buf.String())
+
+	buf.Reset()
+	table.NoHeader = true
+	table.Width = 40
+	require.Nil(t, table.Write(&buf))
+	require.Equal(t, ""+
+		"nobody@example.~  550  5.1.1 The email ~\n"+
+		"full@example.org  452  mailbox full\n", buf.String())
+	for _, line := range bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n")) {
+		require.LessOrEqual(t, len(line), 40)
+	}
+}
+
+func TestEventRow(t *testing.T) {
+	failed := loadTestEvent(t, "failed.json")
+	row, err := eventRow(failed)
+	require.Nil(t, err)
+	require.Equal(t, "failed", row["event"])
+	require.Equal(t, "nobody@example.org", row["recipient"])
+	require.Equal(t, "alice@example.com", row["sender"])
+	require.Equal(t, "Quarterly report", row["subject"])
+	require.Equal(t, "550", row["status"])
+	require.Equal(t, failed.GetID(), row["id"])
+	require.Equal(t, failed.GetTimestamp().Format(time.RFC3339), row["timestamp"])
+
+	created, err := mtypes.NewRFC2822Time("Thu, 16 Oct 2025 12:00:00 UTC")
+	require.Nil(t, err)
+	row = bounceRow(&mtypes.Bounce{Address: "nobody@example.org", Code: "550", Error: "no such user", CreatedAt: created})
+	require.Equal(t, "Thu, 16 Oct 2025 12:00:00 UTC", row["created_at"])
+	require.Equal(t, "550", row["code"])
+}
+
+func TestTableAppend(t *testing.T) {
+	table := Table{Columns: []string{"address", "code"}}
+	var buf bytes.Buffer
+	table.Rows = []map[string]string{{"address": "full@example.org", "code": "452"}}
+	require.Nil(t, table.Append(&buf))
+	require.Empty(t, table.Rows)
+	table.Rows = []map[string]string{{"address": "nobody@example.org", "code": "550"}}
+	require.Nil(t, table.Append(&buf))
+	require.Equal(t, ""+
+		"ADDRESS           CODE\n"+
+		"full@example.org  452\n"+
+		"nobody@example.~  550\n", buf.String())
+}
+
+func TestTableAppendEmptyColumn(t *testing.T) {
+	table := Table{Columns: []string{"event", "status"}, NoHeader: true}
+	var buf bytes.Buffer
+	table.Rows = []map[string]string{{"event": "accepted"}}
+	require.Nil(t, table.Append(&buf))
+	table.Rows = []map[string]string{{"event": "failed", "status": "550"}, {"event": "failed", "status": "5.1.1 mailbox"}}
+	require.Nil(t, table.Append(&buf))
+	require.Equal(t, ""+
+		"accepted  \n"+
+		"failed    550\n"+
+		"failed    5.1.1~\n", buf.String())
+	require.Equal(t, "", truncate("550", 0))
+}
@@ -0,0 +1,216 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	htmltemplate "html/template"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/mailgun/mailgun-go/v5/events"
+	"github.com/spf13/viper"
+)
+
+const defaultBounceSubject = "Delivery status notification: {{.Action}}"
+
+const defaultDigestSubject = "Delivery status digest: {{len .Recipients}} undelivered recipients"
+
+const defaultDigestTemplate = `    Hi!
+
+    This is the MAILER-DAEMON, please DO NOT REPLY to this email.
+
+    Delivery problems occurred for more of your recipients than can
+    be reported individually. The following recipients of your
+    messages were not delivered:
+
+{{range .Recipients}}{{.Recipient}}: {{.Action}} {{.Status}} {{.Code}} {{.Message}}
+    Category: {{.Category}}
+    Message-ID <{{.MessageID}}> {{.Subject}}
+{{end}}`
+
+const defaultComplaintSubject = "Abuse report: {{.Message.Headers.Subject}}"
+
+const defaultComplaintTemplate = `    This is an abuse report for a message sent through {{.Domain}}.
+
+    The recipient {{.Recipient}} reported the following message
+    as spam:
+
+    Message-ID: <{{.Message.Headers.MessageID}}>
+    From: {{.Message.Headers.From}}
+    Subject: {{.Message.Headers.Subject}}
+
+    The headers of the original message are attached.
+`
+
+const defaultBounceTemplate = `    Hi!
+
+    This is the MAILER-DAEMON, please DO NOT REPLY to this email.
+
+{{if eq .Action "delayed"}}    Delivery of a message has been delayed for the following list
+    of recipients. This is a warning only; delivery will be retried
+    and you do not need to resend the message:
+{{else}}    An error has occurred while attempting to deliver a message
+    for the following list of recipients:
+{{end}}
+{{range .Recipients}}{{.Recipient}}: {{.Code}} {{.Message}}
+    Category: {{.Category}}
+{{end}}
+{{if .OriginalAttached}}    A copy of the original message is attached.{{else}}    The headers of the original message are attached.{{end}}
+`
+
+// BounceData is the data passed to bounce templates
+type BounceData struct {
+	*events.Failed
+	Action           string
+	Status           string
+	Recipients       []RecipientStatus
+	Domain           string
+	Hostname         string
+	OriginalAttached bool
+}
+
+// ComplaintData is the data passed to complaint report templates
+type ComplaintData struct {
+	*events.Complained
+	Domain   string
+	Hostname string
+}
+
+// DigestData is the data passed to digest templates
+type DigestData struct {
+	Sender     string
+	Recipients []RecipientStatus
+	Domain     string
+	Hostname   string
+}
+
+var builtinTemplates = map[string][2]string{
+	"bounce":    {defaultBounceSubject, defaultBounceTemplate},
+	"digest":    {defaultDigestSubject, defaultDigestTemplate},
+	"complaint": {defaultComplaintSubject, defaultComplaintTemplate},
+}
+
+// BounceTemplate renders the subject and human-readable parts of a bounce
+type BounceTemplate struct {
+	name string
+	text *template.Template
+	html *htmltemplate.Template
+}
+
+var templateFuncs = map[string]any{
+	"join":  strings.Join,
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+}
+
+// TemplateDir returns the bounce template directory, by default the
+// templates subdirectory beside the config file in use
+func TemplateDir() string {
+	dir := viper.GetString("template_dir")
+	if dir != "" {
+		return dir
+	}
+	if viper.ConfigFileUsed() != "" {
+		return filepath.Join(filepath.Dir(viper.ConfigFileUsed()), "templates")
+	}
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(configDir, "mailgun", "templates")
+}
+
+// templateFile returns the most specific template file for the domain and
+// language, or an empty string if none exists
+func templateFile(dir, domain, language, name, ext string) string {
+	candidates := []string{}
+	for _, base := range []string{filepath.Join(dir, domain), dir} {
+		if language != "" {
+			candidates = append(candidates, filepath.Join(base, name+"."+language+ext))
+		}
+		candidates = append(candidates, filepath.Join(base, name+ext))
+	}
+	for _, pathname := range candidates {
+		if IsFile(pathname) {
+			return pathname
+		}
+	}
+	return ""
+}
+
+// LoadBounceTemplate loads the named templates, bounce, digest or
+// complaint, for a domain from the template directory; a text template may
+// {{define "subject"}} and falls back to the built-in template for anything
+// it does not define
+func LoadBounceTemplate(domain, name string) (*BounceTemplate, error) {
+	builtin, ok := builtinTemplates[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown template: %s", name)
+	}
+	text, err := template.New(name).Funcs(templateFuncs).Parse(builtin[1])
+	if err != nil {
+		return nil, err
+	}
+	_, err = text.New("subject").Parse(builtin[0])
+	if err != nil {
+		return nil, err
+	}
+	bt := BounceTemplate{name: name, text: text}
+
+	dir := TemplateDir()
+	if dir == "" || !IsDir(dir) {
+		return &bt, nil
+	}
+	language := DomainString(domain, "bounce_language")
+
+	pathname := templateFile(dir, domain, language, name, ".txt")
+	if pathname != "" {
+		data, err := os.ReadFile(pathname)
+		if err != nil {
+			return nil, err
+		}
+		_, err = bt.text.Parse(string(data))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	pathname = templateFile(dir, domain, language, name, ".html")
+	if pathname != "" {
+		data, err := os.ReadFile(pathname)
+		if err != nil {
+			return nil, err
+		}
+		bt.html, err = htmltemplate.New(name).Funcs(templateFuncs).Parse(string(data))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &bt, nil
+}
+
+// Render executes the templates, returning the subject, the plain text body
+// and the HTML body, which is nil when no HTML template is configured
+func (t *BounceTemplate) Render(data any) (string, []byte, []byte, error) {
+	var subject bytes.Buffer
+	err := t.text.ExecuteTemplate(&subject, "subject", data)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	var text bytes.Buffer
+	err = t.text.ExecuteTemplate(&text, t.name, data)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	if t.html == nil {
+		return strings.TrimSpace(subject.String()), text.Bytes(), nil, nil
+	}
+	var html bytes.Buffer
+	err = t.html.Execute(&html, data)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	return strings.TrimSpace(subject.String()), text.Bytes(), html.Bytes(), nil
+}
@@ -0,0 +1,297 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mailgun/mailgun-go/v5/events"
+)
+
+// trace steps that are not mailgun events
+const (
+	TraceBounce          = "bounce"
+	TraceComplaintReport = "complaint_report"
+)
+
+// traceOrder places steps with the same timestamp in lifecycle order
+var traceOrder = map[string]int{
+	events.EventAccepted:     0,
+	events.EventRejected:     1,
+	events.EventDelivered:    2,
+	events.EventFailed:       2,
+	TraceBounce:              3,
+	events.EventOpened:       4,
+	events.EventClicked:      5,
+	events.EventUnsubscribed: 6,
+	events.EventComplained:   7,
+	TraceComplaintReport:     8,
+}
+
+// TraceStep is an event in the delivery lifecycle of a message, or a bounce
+// or complaint report generated for one; Elapsed is the time since the
+// message was accepted for the recipient
+type TraceStep struct {
+	Timestamp time.Time `json:"timestamp"`
+	Elapsed   string    `json:"elapsed,omitempty"`
+	Step      string    `json:"step"`
+	Recipient string    `json:"recipient"`
+	MessageID string    `json:"message_id"`
+	EventID   string    `json:"event_id"`
+	Detail    string    `json:"detail,omitempty"`
+}
+
+// TraceOutcome is the delivery outcome of a message for one recipient
+type TraceOutcome struct {
+	MessageID  string    `json:"message_id"`
+	Recipient  string    `json:"recipient"`
+	Outcome    string    `json:"outcome"`
+	Accepted   time.Time `json:"accepted"`
+	Completed  time.Time `json:"completed"`
+	Elapsed    string    `json:"elapsed,omitempty"`
+	Engagement []string  `json:"engagement,omitempty"`
+	Bounce     string    `json:"bounce,omitempty"`
+}
+
+// Trace is the delivery lifecycle of the messages selected by a Message-ID
+// or recipient address
+type Trace struct {
+	Query      string         `json:"query"`
+	Steps      []TraceStep    `json:"steps"`
+	Recipients []TraceOutcome `json:"recipients"`
+}
+
+// traceMatch reports whether an event is for the traced Message-ID or
+// recipient
+func traceMatch(query string, fields *eventFields) bool {
+	messageID := strings.Trim(fields.Message.Headers.MessageID, "<>")
+	return strings.EqualFold(strings.Trim(query, "<>"), messageID) || strings.EqualFold(query, fields.Recipient)
+}
+
+// traceDetail summarizes the outcome of an event
+func traceDetail(event events.Event, fields *eventFields) string {
+	details := []string{}
+	if event.GetName() == events.EventFailed {
+		details = append(details, fields.Severity)
+	}
+	if fields.DeliveryStatus.Code != 0 {
+		details = append(details, strconv.Itoa(fields.DeliveryStatus.Code))
+	}
+	switch {
+	case fields.DeliveryStatus.Message != "":
+		details = append(details, fields.DeliveryStatus.Message)
+	case fields.DeliveryStatus.Description != "":
+		details = append(details, fields.DeliveryStatus.Description)
+	case fields.Reason != "" && event.GetName() == events.EventFailed:
+		details = append(details, fields.Reason)
+	}
+	if fields.URL != "" {
+		details = append(details, fields.URL)
+	}
+	return strings.Join(details, " ")
+}
+
+// bounceTraceStep returns the step for a bounce generated for a failed event
+func (c *Client) bounceTraceStep(step *TraceStep) (*TraceStep, error) {
+	record, err := c.BouncedRecord(step.EventID)
+	if err != nil {
+		return nil, err
+	}
+	entry := BouncedEntry{Key: step.EventID, BounceRecord: *record}
+	bounce := TraceStep{
+		Timestamp: record.Timestamp,
+		Step:      TraceBounce,
+		Recipient: step.Recipient,
+		MessageID: step.MessageID,
+		EventID:   step.EventID,
+	}
+	if bounce.Timestamp.IsZero() {
+		bounce.Timestamp = step.Timestamp
+	}
+	details := []string{bouncedResult(&entry)}
+	for _, value := range []string{record.Action, record.Status, record.Category} {
+		if value != "" {
+			details = append(details, value)
+		}
+	}
+	if record.Sender != "" {
+		details = append(details, "to "+record.Sender)
+	}
+	if record.Suppressed != "" {
+		details = append(details, fmt.Sprintf("(%s)", record.Suppressed))
+	}
+	bounce.Detail = strings.Join(details, " ")
+	return &bounce, nil
+}
+
+// complaintTraceStep returns the step for a complaint report generated for
+// a complained event
+func (c *Client) complaintTraceStep(step *TraceStep) (*TraceStep, error) {
+	var record ComplaintRecord
+	_, err := c.cdb.GetObject(step.EventID, &record)
+	if err != nil {
+		return nil, err
+	}
+	report := TraceStep{
+		Timestamp: record.Timestamp,
+		Step:      TraceComplaintReport,
+		Recipient: step.Recipient,
+		MessageID: step.MessageID,
+		EventID:   step.EventID,
+	}
+	switch {
+	case record.Suppressed != "":
+		report.Detail = fmt.Sprintf("suppressed (%s)", record.Suppressed)
+	case record.Queued:
+		report.Detail = "queued to " + record.ReportTo
+	default:
+		report.Detail = "sent to " + record.ReportTo
+	}
+	return &report, nil
+}
+
+// TraceMessage collects the stored events for a Message-ID or recipient
+// address, with the bounces and complaint reports generated for them, in
+// lifecycle order, and the outcome for each message and recipient
+func (c *Client) TraceMessage(query string) (*Trace, error) {
+	stored, err := c.LocalEvents(&EventFilter{Ascending: true})
+	if err != nil {
+		return nil, err
+	}
+	trace := Trace{Query: query, Steps: []TraceStep{}, Recipients: []TraceOutcome{}}
+	for _, event := range *stored {
+		fields, err := fieldsOf(event)
+		if err != nil {
+			return nil, err
+		}
+		if !traceMatch(query, fields) {
+			continue
+		}
+		step := TraceStep{
+			Timestamp: event.GetTimestamp(),
+			Step:      event.GetName(),
+			Recipient: strings.ToLower(fields.Recipient),
+			MessageID: strings.Trim(fields.Message.Headers.MessageID, "<>"),
+			EventID:   event.GetID(),
+			Detail:    traceDetail(event, fields),
+		}
+		trace.Steps = append(trace.Steps, step)
+		var generated *TraceStep
+		switch {
+		case step.Step == events.EventFailed && c.bdb.Has(step.EventID):
+			generated, err = c.bounceTraceStep(&step)
+		case step.Step == events.EventComplained && c.cdb.Has(step.EventID):
+			generated, err = c.complaintTraceStep(&step)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if generated != nil {
+			trace.Steps = append(trace.Steps, *generated)
+		}
+	}
+	sort.SliceStable(trace.Steps, func(i, j int) bool {
+		if trace.Steps[i].Timestamp.Equal(trace.Steps[j].Timestamp) {
+			return traceOrder[trace.Steps[i].Step] < traceOrder[trace.Steps[j].Step]
+		}
+		return trace.Steps[i].Timestamp.Before(trace.Steps[j].Timestamp)
+	})
+	trace.outcomes()
+	return &trace, nil
+}
+
+// traceElapsed formats the time between two steps
+func traceElapsed(begin, end time.Time) string {
+	if begin.IsZero() || end.Before(begin) {
+		return ""
+	}
+	return end.Sub(begin).Round(time.Millisecond).String()
+}
+
+// outcomes sets the step elapsed times and the outcome of each message and
+// recipient: the last delivery event, with a temporary failure reported as
+// deferred, followed by the engagement events and the generated bounce
+func (t *Trace) outcomes() {
+	index := map[string]int{}
+	for i := range t.Steps {
+		step := &t.Steps[i]
+		key := step.MessageID + " " + step.Recipient
+		n, ok := index[key]
+		if !ok {
+			n = len(t.Recipients)
+			index[key] = n
+			t.Recipients = append(t.Recipients, TraceOutcome{MessageID: step.MessageID, Recipient: step.Recipient})
+		}
+		outcome := &t.Recipients[n]
+		switch step.Step {
+		case events.EventAccepted:
+			if outcome.Accepted.IsZero() {
+				outcome.Accepted = step.Timestamp
+			}
+			if outcome.Outcome == "" {
+				outcome.Outcome = "accepted"
+			}
+		case events.EventDelivered, events.EventRejected:
+			outcome.Outcome = step.Step
+			outcome.Completed = step.Timestamp
+		case events.EventFailed:
+			outcome.Outcome = step.Step
+			if strings.HasPrefix(step.Detail, "temporary") {
+				outcome.Outcome = "deferred"
+			}
+			outcome.Completed = step.Timestamp
+		case TraceBounce:
+			outcome.Bounce = step.Detail
+		case TraceComplaintReport:
+		default:
+			found := false
+			for _, name := range outcome.Engagement {
+				found = found || name == step.Step
+			}
+			if !found {
+				outcome.Engagement = append(outcome.Engagement, step.Step)
+			}
+		}
+		step.Elapsed = traceElapsed(outcome.Accepted, step.Timestamp)
+	}
+	for i := range t.Recipients {
+		outcome := &t.Recipients[i]
+		if outcome.Outcome == "" {
+			outcome.Outcome = "unknown"
+		}
+		if !outcome.Completed.IsZero() {
+			outcome.Elapsed = traceElapsed(outcome.Accepted, outcome.Completed)
+		}
+	}
+}
+
+var traceColumns = []string{"timestamp", "elapsed", "step", "recipient", "message_id", "event_id", "detail"}
+
+// traceRow returns the table column values for a step
+func traceRow(step *TraceStep) map[string]string {
+	return map[string]string{
+		"timestamp":  step.Timestamp.Format(time.RFC3339),
+		"elapsed":    step.Elapsed,
+		"step":       step.Step,
+		"recipient":  step.Recipient,
+		"message_id": step.MessageID,
+		"event_id":   step.EventID,
+		"detail":     step.Detail,
+	}
+}
+
+var traceOutcomeColumns = []string{"recipient", "outcome", "elapsed", "engagement", "bounce", "message_id"}
+
+// traceOutcomeRow returns the table column values for a recipient outcome
+func traceOutcomeRow(outcome *TraceOutcome) map[string]string {
+	return map[string]string{
+		"recipient":  outcome.Recipient,
+		"outcome":    outcome.Outcome,
+		"elapsed":    outcome.Elapsed,
+		"engagement": strings.Join(outcome.Engagement, ","),
+		"bounce":     outcome.Bounce,
+		"message_id": outcome.MessageID,
+	}
+}
@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mailgun/mailgun-go/v5/events"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTraceMessage(t *testing.T) {
+	api, _ := newTestClient(t)
+	failed := loadTestEvent(t, "failed.json").(*events.Failed)
+	messageID := failed.Message.Headers.MessageID
+
+	accepted := events.Accepted{
+		Generic:   events.Generic{EventName: events.EventName{Name: events.EventAccepted}, ID: "accepted-1", Timestamp: failed.Timestamp - 2},
+		Message:   events.Message{Headers: events.MessageHeaders{MessageID: messageID}},
+		Recipient: failed.Recipient,
+	}
+	deferred := failedVariant(t, "deferred-1", "temporary")
+	deferred.Timestamp = failed.Timestamp - 1
+	for _, event := range []events.Event{failed, &accepted, deferred, loadTestEvent(t, "complained.json")} {
+		require.Nil(t, api.storeEvent(event))
+	}
+	require.Nil(t, api.bdb.SetObject(failed.GetID(), &BounceRecord{
+		Timestamp: failed.GetTimestamp().Add(time.Minute),
+		Sender:    "alice@example.com",
+		Action:    "failed",
+		Status:    "5.1.1",
+	}))
+
+	for _, query := range []string{"<" + messageID + ">", "Nobody@example.org"} {
+		trace, err := api.TraceMessage(query)
+		require.Nil(t, err)
+		steps := []string{}
+		elapsed := []string{}
+		for _, step := range trace.Steps {
+			steps = append(steps, step.Step)
+			elapsed = append(elapsed, step.Elapsed)
+		}
+		require.Equal(t, []string{"accepted", "failed", "failed", "bounce"}, steps)
+		require.Equal(t, []string{"0s", "1s", "2s", "1m2s"}, elapsed)
+		require.Equal(t, "temporary 452 mailbox full", trace.Steps[1].Detail)
+		require.Equal(t, "sent failed 5.1.1 to alice@example.com", trace.Steps[3].Detail)
+		require.Len(t, trace.Recipients, 1)
+		outcome := trace.Recipients[0]
+		require.Equal(t, "nobody@example.org", outcome.Recipient)
+		require.Equal(t, "failed", outcome.Outcome)
+		require.Equal(t, "2s", outcome.Elapsed)
+		require.Equal(t, trace.Steps[3].Detail, outcome.Bounce)
+	}
+
+	complaint := loadTestEvent(t, "complained.json")
+	require.Nil(t, api.cdb.SetObject(complaint.GetID(), &ComplaintRecord{
+		Timestamp: complaint.GetTimestamp().Add(time.Second),
+		Recipient: "carol@example.org",
+		ReportTo:  "abuse@example.com",
+	}))
+	trace, err := api.TraceMessage("carol@example.org")
+	require.Nil(t, err)
+	require.Len(t, trace.Steps, 2)
+	require.Equal(t, TraceComplaintReport, trace.Steps[1].Step)
+	require.Equal(t, "sent to abuse@example.com", trace.Steps[1].Detail)
+	require.Equal(t, "unknown", trace.Recipients[0].Outcome)
+	require.Equal(t, []string{"complained"}, trace.Recipients[0].Engagement)
+
+	trace, err = api.TraceMessage("nobody@example.net")
+	require.Nil(t, err)
+	require.Empty(t, trace.Steps)
+}
@@ -0,0 +1,127 @@
+/*
+Copyright © 2025 Matt Krueger <mkrueger@rstms.net>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+ 1. Redistributions of source code must retain the above copyright notice,
+    this list of conditions and the following disclaimer.
+
+ 2. Redistributions in binary form must reproduce the above copyright notice,
+    this list of conditions and the following disclaimer in the documentation
+    and/or other materials provided with the distribution.
+
+ 3. Neither the name of the copyright holder nor the names of its contributors
+    may be used to endorse or promote products derived from this software
+    without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+POSSIBILITY OF SUCH DAMAGE.
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var traceAPI bool
+var traceBegin string
+
+var traceCmd = &cobra.Command{
+	Use:   "trace MESSAGE_ID|RECIPIENT",
+	Short: "show the delivery lifecycle of a message",
+	Long: `
+Collect the stored events for a Message-ID or a recipient address and show
+them in time order with the time since each message was accepted, followed
+by the outcome for each message and recipient.  Bounces generated from
+failed events and complaint reports generated from complained events are
+included from the bounced and complaints stores.
+
+With --api the mailgun events API is queried first and the returned events
+are stored; --begin sets the start of the query as for the events command.
+
+The json output holds the steps and the recipient outcomes; the other
+structured formats write the steps.
+`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		api := NewClient()
+		if traceAPI {
+			begin, err := ParseEventTime(traceBegin, time.Now())
+			cobra.CheckErr(err)
+			for _, filter := range []EventFilter{{Begin: begin, MessageID: args[0]}, {Begin: begin, Recipient: args[0]}} {
+				_, err := api.FilterEvents(&filter)
+				cobra.CheckErr(err)
+			}
+		}
+		trace, err := api.TraceMessage(args[0])
+		cobra.CheckErr(err)
+		if len(trace.Steps) == 0 {
+			cobra.CheckErr(fmt.Errorf("no events found for %s", args[0]))
+		}
+		format := OutputFormat(OutputText)
+		switch format {
+		case OutputText:
+			cobra.CheckErr(writeTraceText(trace))
+			return
+		case OutputJSON:
+			fmt.Println(FormatJSON(trace))
+			return
+		}
+		output, err := NewOutput(os.Stdout, format, traceColumns, false)
+		cobra.CheckErr(err)
+		for _, step := range trace.Steps {
+			cobra.CheckErr(output.Write(step, traceRow(&step)))
+		}
+		cobra.CheckErr(output.Close())
+	},
+}
+
+// writeTraceText writes the steps and recipient outcomes as two tables,
+// omitting the Message-ID column when a single message is traced
+func writeTraceText(trace *Trace) error {
+	stepColumns := []string{"timestamp", "elapsed", "step", "recipient", "detail"}
+	outcomeColumns := []string{"recipient", "outcome", "elapsed", "engagement", "bounce"}
+	messages := map[string]bool{}
+	for _, outcome := range trace.Recipients {
+		messages[outcome.MessageID] = true
+	}
+	if len(messages) > 1 {
+		stepColumns = []string{"timestamp", "elapsed", "step", "recipient", "message_id", "detail"}
+		outcomeColumns = traceOutcomeColumns
+	}
+	steps := Table{Columns: stepColumns, Width: terminalWidth()}
+	for _, step := range trace.Steps {
+		steps.Rows = append(steps.Rows, traceRow(&step))
+	}
+	err := steps.Write(os.Stdout)
+	if err != nil {
+		return err
+	}
+	fmt.Println()
+	outcomes := Table{Columns: outcomeColumns, Width: terminalWidth()}
+	for _, outcome := range trace.Recipients {
+		outcomes.Rows = append(outcomes.Rows, traceOutcomeRow(&outcome))
+	}
+	return outcomes.Write(os.Stdout)
+}
+
+func init() {
+	rootCmd.AddCommand(traceCmd)
+	traceCmd.Flags().BoolVarP(&traceAPI, "api", "A", false, "query the mailgun events API first")
+	traceCmd.Flags().StringVarP(&traceBegin, "begin", "b", "", "earliest event time for the API query")
+}
@@ -0,0 +1,173 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-sasl"
+	"github.com/emersion/go-smtp"
+	"github.com/spf13/viper"
+)
+
+// Transport submits a rendered message to the mail system; a sender of <>
+// is the null reverse-path, and an empty sender leaves the envelope sender
+// to the transport default
+type Transport interface {
+	Name() string
+	Send(sender string, recipients []string, message []byte) error
+}
+
+func initTransportConfig() {
+	viper.SetDefault("bounce_transport", "sendmail")
+	viper.SetDefault("sendmail_command", "sendmail")
+	viper.SetDefault("smtp_host", "localhost")
+	viper.SetDefault("smtp_port", 25)
+	viper.SetDefault("smtp_tls", "none")
+	viper.SetDefault("smtp_auth", "plain")
+	viper.SetDefault("smtp_timeout", 30)
+	viper.SetDefault("lmtp_socket", "/var/run/lmtp.sock")
+}
+
+// NewTransport returns the transport selected by the bounce_transport config key
+func NewTransport() (Transport, error) {
+	mode := strings.ToLower(viper.GetString("bounce_transport"))
+	switch mode {
+	case "sendmail":
+		return &SendmailTransport{command: viper.GetString("sendmail_command")}, nil
+	case "smtp":
+		security := strings.ToLower(viper.GetString("smtp_tls"))
+		switch security {
+		case "none", "starttls", "implicit":
+		default:
+			return nil, fmt.Errorf("unsupported smtp_tls mode: %s", security)
+		}
+		auth := strings.ToLower(viper.GetString("smtp_auth"))
+		switch auth {
+		case "plain", "login":
+		default:
+			return nil, fmt.Errorf("unsupported smtp_auth mechanism: %s", auth)
+		}
+		host := viper.GetString("smtp_host")
+		return &SMTPTransport{
+			network:  "tcp",
+			address:  net.JoinHostPort(host, viper.GetString("smtp_port")),
+			security: security,
+			tlsConfig: &tls.Config{
+				ServerName:         host,
+				InsecureSkipVerify: viper.GetBool("smtp_tls_insecure"),
+			},
+			auth:     auth,
+			username: viper.GetString("smtp_username"),
+			password: viper.GetString("smtp_password"),
+			timeout:  time.Second * time.Duration(viper.GetInt("smtp_timeout")),
+		}, nil
+	case "lmtp":
+		return &SMTPTransport{
+			network: "unix",
+			address: viper.GetString("lmtp_socket"),
+			lmtp:    true,
+			timeout: time.Second * time.Duration(viper.GetInt("smtp_timeout")),
+		}, nil
+	}
+	return nil, fmt.Errorf("unsupported bounce_transport: %s", mode)
+}
+
+// SendmailTransport pipes the message to a local sendmail binary, which reads
+// the recipients from the message header
+type SendmailTransport struct {
+	command string
+}
+
+func (t *SendmailTransport) Name() string {
+	return "sendmail"
+}
+
+func (t *SendmailTransport) Send(sender string, recipients []string, message []byte) error {
+	args := []string{"-t"}
+	if sender != "" {
+		args = append(args, "-f", sender)
+	}
+	cmd := exec.Command(t.command, args...)
+	cmd.Stdin = bytes.NewReader(message)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("sendmail failed: %s", string(output))
+	}
+	return nil
+}
+
+// SMTPTransport submits the message to an SMTP server over TCP or to an
+// LMTP server listening on a unix socket
+type SMTPTransport struct {
+	network   string
+	address   string
+	security  string
+	tlsConfig *tls.Config
+	lmtp      bool
+	auth      string
+	username  string
+	password  string
+	timeout   time.Duration
+}
+
+func (t *SMTPTransport) Name() string {
+	if t.lmtp {
+		return "lmtp"
+	}
+	return "smtp"
+}
+
+func (t *SMTPTransport) dial() (*smtp.Client, error) {
+	dialer := net.Dialer{Timeout: t.timeout}
+	if t.security == "implicit" {
+		conn, err := tls.DialWithDialer(&dialer, t.network, t.address, t.tlsConfig)
+		if err != nil {
+			return nil, err
+		}
+		return smtp.NewClient(conn), nil
+	}
+	conn, err := dialer.Dial(t.network, t.address)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case t.lmtp:
+		return smtp.NewClientLMTP(conn), nil
+	case t.security == "starttls":
+		return smtp.NewClientStartTLS(conn, t.tlsConfig)
+	}
+	return smtp.NewClient(conn), nil
+}
+
+func (t *SMTPTransport) Send(sender string, recipients []string, message []byte) error {
+	client, err := t.dial()
+	if err != nil {
+		return fmt.Errorf("%s transport: %v", t.Name(), err)
+	}
+	defer client.Close()
+	if t.username != "" {
+		var saslClient sasl.Client
+		if t.auth == "login" {
+			saslClient = sasl.NewLoginClient(t.username, t.password)
+		} else {
+			saslClient = sasl.NewPlainClient("", t.username, t.password)
+		}
+		err = client.Auth(saslClient)
+		if err != nil {
+			return fmt.Errorf("%s transport: %v", t.Name(), err)
+		}
+	}
+	if sender == "<>" {
+		sender = ""
+	}
+	err = client.SendMail(sender, recipients, bytes.NewReader(message))
+	if err != nil {
+		return fmt.Errorf("%s transport: %v", t.Name(), err)
+	}
+	return client.Quit()
+}
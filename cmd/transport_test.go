@@ -0,0 +1,264 @@
+package cmd
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-sasl"
+	"github.com/emersion/go-smtp"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+)
+
+const testSMTPUser = "bouncer"
+const testSMTPPassword = "secret"
+
+type testMessage struct {
+	Sender     string
+	Recipients []string
+	Data       []byte
+	Username   string
+}
+
+// testMTA is an in-process SMTP/LMTP stand-in recording delivered messages
+type testMTA struct {
+	mutex    sync.Mutex
+	messages []testMessage
+}
+
+func (m *testMTA) NewSession(c *smtp.Conn) (smtp.Session, error) {
+	return &testSession{mta: m}, nil
+}
+
+func (m *testMTA) Messages() []testMessage {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return append([]testMessage{}, m.messages...)
+}
+
+type testSession struct {
+	mta     *testMTA
+	message testMessage
+	user    string
+}
+
+func (s *testSession) AuthMechanisms() []string {
+	return []string{sasl.Plain, sasl.Login}
+}
+
+func (s *testSession) Auth(mech string) (sasl.Server, error) {
+	if mech == sasl.Login {
+		return &testLoginServer{session: s}, nil
+	}
+	return sasl.NewPlainServer(func(identity, username, password string) error {
+		return s.login(username, password)
+	}), nil
+}
+
+func (s *testSession) login(username, password string) error {
+	if username != testSMTPUser || password != testSMTPPassword {
+		return errors.New("invalid credentials")
+	}
+	s.user = username
+	return nil
+}
+
+func (s *testSession) Mail(from string, opts *smtp.MailOptions) error {
+	s.message = testMessage{Sender: from, Username: s.user}
+	return nil
+}
+
+func (s *testSession) Rcpt(to string, opts *smtp.RcptOptions) error {
+	s.message.Recipients = append(s.message.Recipients, to)
+	return nil
+}
+
+func (s *testSession) Data(r io.Reader) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	s.message.Data = data
+	s.mta.mutex.Lock()
+	defer s.mta.mutex.Unlock()
+	s.mta.messages = append(s.mta.messages, s.message)
+	return nil
+}
+
+func (s *testSession) Reset() {}
+
+func (s *testSession) Logout() error {
+	return nil
+}
+
+// testLoginServer implements the server side of the SASL LOGIN mechanism
+type testLoginServer struct {
+	session  *testSession
+	username *string
+}
+
+func (l *testLoginServer) Next(response []byte) ([]byte, bool, error) {
+	if l.username == nil {
+		if response == nil {
+			return []byte("Username:"), false, nil
+		}
+		username := string(response)
+		l.username = &username
+		return []byte("Password:"), false, nil
+	}
+	return nil, true, l.session.login(*l.username, string(response))
+}
+
+func testTLSConfig(t *testing.T) *tls.Config {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.Nil(t, err)
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	require.Nil(t, err)
+	return &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}
+}
+
+// startTestMTA runs an in-process server on a new listener and returns the
+// recorder and listen address
+func startTestMTA(t *testing.T, network string, lmtp bool, implicitTLS bool) (*testMTA, string) {
+	mta := &testMTA{}
+	server := smtp.NewServer(mta)
+	server.Domain = "localhost"
+	server.LMTP = lmtp
+	server.AllowInsecureAuth = true
+	server.TLSConfig = testTLSConfig(t)
+
+	address := "127.0.0.1:0"
+	if network == "unix" {
+		address = filepath.Join(t.TempDir(), "lmtp.sock")
+	}
+	var listener net.Listener
+	var err error
+	if implicitTLS {
+		listener, err = tls.Listen(network, address, server.TLSConfig)
+	} else {
+		listener, err = net.Listen(network, address)
+	}
+	require.Nil(t, err)
+	go server.Serve(listener)
+	t.Cleanup(func() { server.Close() })
+	return mta, listener.Addr().String()
+}
+
+func configureSMTPTransport(t *testing.T, address, security, auth string) Transport {
+	host, port, err := net.SplitHostPort(address)
+	require.Nil(t, err)
+	viper.Set("bounce_transport", "smtp")
+	viper.Set("smtp_host", host)
+	viper.Set("smtp_port", port)
+	viper.Set("smtp_tls", security)
+	viper.Set("smtp_tls_insecure", true)
+	viper.Set("smtp_auth", auth)
+	viper.Set("smtp_username", testSMTPUser)
+	viper.Set("smtp_password", testSMTPPassword)
+	t.Cleanup(func() { viper.Set("bounce_transport", "sendmail") })
+	transport, err := NewTransport()
+	require.Nil(t, err)
+	require.Equal(t, "smtp", transport.Name())
+	return transport
+}
+
+func TestSMTPTransport(t *testing.T) {
+	initTestConfig()
+	message := []byte("From: <MAILER-DAEMON@localhost>\r\nTo: <alice@example.com>\r\nSubject: test\r\n\r\nhello\r\n")
+	cases := []struct {
+		security string
+		auth     string
+	}{
+		{"none", "plain"},
+		{"none", "login"},
+		{"starttls", "plain"},
+		{"implicit", "login"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.security+"_"+tc.auth, func(t *testing.T) {
+			mta, address := startTestMTA(t, "tcp", false, tc.security == "implicit")
+			transport := configureSMTPTransport(t, address, tc.security, tc.auth)
+			err := transport.Send("<>", []string{"alice@example.com"}, message)
+			require.Nil(t, err)
+			messages := mta.Messages()
+			require.Len(t, messages, 1)
+			require.Equal(t, "", messages[0].Sender)
+			require.Equal(t, []string{"alice@example.com"}, messages[0].Recipients)
+			require.Equal(t, testSMTPUser, messages[0].Username)
+			require.Equal(t, string(message), string(messages[0].Data))
+		})
+	}
+}
+
+func TestSMTPTransportAuthFailure(t *testing.T) {
+	initTestConfig()
+	_, address := startTestMTA(t, "tcp", false, false)
+	transport := configureSMTPTransport(t, address, "none", "plain")
+	transport.(*SMTPTransport).password = "wrong"
+	err := transport.Send("", []string{"alice@example.com"}, []byte("Subject: test\r\n\r\nhello\r\n"))
+	require.NotNil(t, err)
+}
+
+func TestLMTPTransport(t *testing.T) {
+	initTestConfig()
+	mta, address := startTestMTA(t, "unix", true, false)
+	viper.Set("bounce_transport", "lmtp")
+	viper.Set("lmtp_socket", address)
+	t.Cleanup(func() { viper.Set("bounce_transport", "sendmail") })
+	transport, err := NewTransport()
+	require.Nil(t, err)
+	require.Equal(t, "lmtp", transport.Name())
+	err = transport.Send("", []string{"alice@example.com"}, []byte("Subject: test\r\n\r\nhello\r\n"))
+	require.Nil(t, err)
+	require.Len(t, mta.Messages(), 1)
+}
+
+func TestTransportConfig(t *testing.T) {
+	initTestConfig()
+	t.Cleanup(func() { viper.Set("bounce_transport", "sendmail") })
+	viper.Set("bounce_transport", "carrier-pigeon")
+	_, err := NewTransport()
+	require.NotNil(t, err)
+	viper.Set("bounce_transport", "sendmail")
+	transport, err := NewTransport()
+	require.Nil(t, err)
+	require.Equal(t, "sendmail", transport.Name())
+}
+
+func TestSendmailTransport(t *testing.T) {
+	dir := t.TempDir()
+	command := filepath.Join(dir, "sendmail")
+	args := filepath.Join(dir, "args")
+	err := os.WriteFile(command, []byte("#!/bin/sh\necho \"$@\" >>"+args+"\ncat >/dev/null\n"), 0700)
+	require.Nil(t, err)
+	transport := SendmailTransport{command: command}
+	message := []byte("Subject: test\r\n\r\nhello\r\n")
+	require.Nil(t, transport.Send("bounces@example.com", []string{"alice@example.com"}, message))
+	require.Nil(t, transport.Send("<>", []string{"alice@example.com"}, message))
+	require.Nil(t, transport.Send("", []string{"alice@example.com"}, message))
+	output, err := os.ReadFile(args)
+	require.Nil(t, err)
+	require.Equal(t, []string{"-t -f bounces@example.com", "-t -f <>", "-t"}, strings.Split(strings.TrimSpace(string(output)), "\n"))
+}
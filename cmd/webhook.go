@@ -0,0 +1,207 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mailgun/mailgun-go/v5/events"
+	"github.com/mailgun/mailgun-go/v5/mtypes"
+	"github.com/spf13/viper"
+)
+
+// webhook request bodies larger than this are rejected
+const maxWebhookBody = 1 << 20
+
+// WebhookReceiver accepts mailgun webhook POSTs, verifies their signatures,
+// stores the events and runs the bounce pipeline in the background; lock
+// serializes storing events with the pipeline
+type WebhookReceiver struct {
+	client  *Client
+	maxAge  time.Duration
+	mutex   sync.Mutex
+	lock    sync.Mutex
+	tokens  map[string]time.Time
+	pending chan struct{}
+	process func() error
+	now     func() time.Time
+}
+
+func initWebhookConfig() {
+	viper.SetDefault("webhook_listen", ":8080")
+	viper.SetDefault("webhook_path", "/webhook")
+	viper.SetDefault("webhook_max_age", "5m")
+}
+
+// NewWebhookReceiver returns a receiver feeding events to client, verifying
+// signatures with the webhook_signing_key
+func NewWebhookReceiver(client *Client) (*WebhookReceiver, error) {
+	key := viper.GetString("webhook_signing_key")
+	if key == "" {
+		return nil, fmt.Errorf("webhook_signing_key is not set")
+	}
+	maxAge, err := time.ParseDuration(viper.GetString("webhook_max_age"))
+	if err != nil {
+		return nil, fmt.Errorf("webhook_max_age: %v", err)
+	}
+	client.api.SetWebhookSigningKey(key)
+	r := WebhookReceiver{
+		client:  client,
+		maxAge:  maxAge,
+		tokens:  map[string]time.Time{},
+		pending: make(chan struct{}, 1),
+		now:     time.Now,
+	}
+	r.process = func() error {
+		return client.processEvents(nil, viper.GetBool("no_bounce"))
+	}
+	return &r, nil
+}
+
+// verify checks the signature of a webhook and rejects stale timestamps and
+// tokens that have already been seen, reserving the token of an accepted
+// request so that a concurrent replay is rejected too
+func (r *WebhookReceiver) verify(signature mtypes.Signature) (int, error) {
+	verified, err := r.client.api.VerifyWebhookSignature(signature)
+	if err != nil || !verified {
+		return http.StatusUnauthorized, fmt.Errorf("invalid signature")
+	}
+	seconds, err := strconv.ParseInt(signature.TimeStamp, 10, 64)
+	if err != nil {
+		return http.StatusBadRequest, fmt.Errorf("invalid timestamp: %s", signature.TimeStamp)
+	}
+	now := r.now()
+	age := now.Sub(time.Unix(seconds, 0))
+	if age > r.maxAge || age < -r.maxAge {
+		return http.StatusNotAcceptable, fmt.Errorf("stale timestamp: %s", signature.TimeStamp)
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for token, expires := range r.tokens {
+		if now.After(expires) {
+			delete(r.tokens, token)
+		}
+	}
+	if _, ok := r.tokens[signature.Token]; ok {
+		return http.StatusNotAcceptable, fmt.Errorf("replayed token: %s", signature.Token)
+	}
+	r.tokens[signature.Token] = now.Add(2 * r.maxAge)
+	return http.StatusOK, nil
+}
+
+// release forgets a reserved token when its event could not be stored, so
+// that mailgun can retry the request
+func (r *WebhookReceiver) release(signature mtypes.Signature) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	delete(r.tokens, signature.Token)
+}
+
+// ServeHTTP handles a webhook POST
+func (r *WebhookReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	status, err := r.receive(w, req)
+	if err != nil {
+		log.Printf("webhook_rejected: %s %v\n", req.RemoteAddr, err)
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (r *WebhookReceiver) receive(w http.ResponseWriter, req *http.Request) (int, error) {
+	if req.Method != http.MethodPost {
+		return http.StatusMethodNotAllowed, fmt.Errorf("method not allowed: %s", req.Method)
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, req.Body, maxWebhookBody))
+	if err != nil {
+		return http.StatusRequestEntityTooLarge, err
+	}
+	var payload mtypes.WebhookPayload
+	err = json.Unmarshal(body, &payload)
+	if err != nil {
+		return http.StatusBadRequest, fmt.Errorf("invalid payload: %v", err)
+	}
+	status, err := r.verify(payload.Signature)
+	if err != nil {
+		return status, err
+	}
+	event, err := events.ParseEvent(payload.EventData)
+	if err != nil {
+		// mailgun does not retry a webhook answered with 406
+		return http.StatusNotAcceptable, err
+	}
+	r.lock.Lock()
+	err = r.client.receiveEvent(event)
+	if err == nil && viper.GetBool("verbose") {
+		log.Printf("webhook_event: %s %s\n", event.GetID(), event.GetName())
+	}
+	r.lock.Unlock()
+	if err != nil {
+		r.release(payload.Signature)
+		return http.StatusInternalServerError, err
+	}
+	select {
+	case r.pending <- struct{}{}:
+	default:
+	}
+	return http.StatusOK, nil
+}
+
+// Process runs the bounce pipeline after events are received, and every
+// poll_interval so that bounces held for the collect window are sent, until
+// ctx is cancelled
+func (r *WebhookReceiver) Process(ctx context.Context) {
+	ticker := time.NewTicker(time.Second * time.Duration(max(viper.GetInt("poll_interval"), 1)))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-r.pending:
+		case <-ticker.C:
+		}
+		r.lock.Lock()
+		err := r.process()
+		r.lock.Unlock()
+		if err != nil {
+			log.Printf("webhook_process_failed: %v\n", err)
+		}
+	}
+}
+
+// ListenAndServe runs the webhook listener on webhook_listen, using TLS when
+// webhook_tls_cert and webhook_tls_key are set
+func (r *WebhookReceiver) ListenAndServe(ctx context.Context) error {
+	mux := http.NewServeMux()
+	mux.Handle(viper.GetString("webhook_path"), r)
+	server := http.Server{
+		Addr:              viper.GetString("webhook_listen"),
+		Handler:           mux,
+		ReadHeaderTimeout: 30 * time.Second,
+	}
+	go r.Process(ctx)
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+	cert := viper.GetString("webhook_tls_cert")
+	key := viper.GetString("webhook_tls_key")
+	var err error
+	if cert != "" || key != "" {
+		log.Printf("webhook: listening on https://%s%s\n", server.Addr, viper.GetString("webhook_path"))
+		err = server.ListenAndServeTLS(cert, key)
+	} else {
+		log.Printf("webhook: listening on http://%s%s\n", server.Addr, viper.GetString("webhook_path"))
+		err = server.ListenAndServe()
+	}
+	if err == http.ErrServerClosed {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,156 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/mailgun/mailgun-go/v5/mtypes"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+)
+
+const testSigningKey = "key-0123456789abcdef"
+
+// signedWebhook returns a webhook payload for an event fixture signed with
+// the test signing key
+func signedWebhook(t *testing.T, name, key string, timestamp time.Time, token string) []byte {
+	eventData, err := os.ReadFile("testdata/events/" + name)
+	require.Nil(t, err)
+	stamp := strconv.FormatInt(timestamp.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(stamp + token))
+	payload, err := json.Marshal(map[string]any{
+		"signature": map[string]string{
+			"timestamp": stamp,
+			"token":     token,
+			"signature": hex.EncodeToString(mac.Sum(nil)),
+		},
+		"event-data": json.RawMessage(eventData),
+	})
+	require.Nil(t, err)
+	return payload
+}
+
+func newTestReceiver(t *testing.T) (*WebhookReceiver, *Client) {
+	api, _ := newTestClient(t)
+	viper.Set("webhook_signing_key", testSigningKey)
+	t.Cleanup(func() { viper.Set("webhook_signing_key", "") })
+	receiver, err := NewWebhookReceiver(api)
+	require.Nil(t, err)
+	receiver.process = func() error { return nil }
+	return receiver, api
+}
+
+func postWebhook(receiver *WebhookReceiver, payload []byte) int {
+	request := httptest.NewRequest(http.MethodPost, "/webhook", bytes.NewReader(payload))
+	recorder := httptest.NewRecorder()
+	receiver.ServeHTTP(recorder, request)
+	return recorder.Code
+}
+
+func TestWebhookReceiver(t *testing.T) {
+	receiver, api := newTestReceiver(t)
+	now := time.Now()
+
+	payload := signedWebhook(t, "failed.json", testSigningKey, now, "token-1")
+	require.Equal(t, http.StatusOK, postWebhook(receiver, payload))
+	event := loadTestEvent(t, "failed.json")
+	require.True(t, api.edb.Has(event.GetID()))
+	select {
+	case <-receiver.pending:
+	default:
+		t.Fatal("bounce pipeline not signaled")
+	}
+
+	// replayed token
+	require.Equal(t, http.StatusNotAcceptable, postWebhook(receiver, payload))
+
+	// the same event with a new token is accepted and stored once
+	require.Equal(t, http.StatusOK, postWebhook(receiver, signedWebhook(t, "failed.json", testSigningKey, now, "token-2")))
+	keys, err := api.edb.Keys()
+	require.Nil(t, err)
+	require.Len(t, keys, 1)
+
+	require.Equal(t, http.StatusOK, postWebhook(receiver, signedWebhook(t, "complained.json", testSigningKey, now, "token-3")))
+	require.True(t, api.edb.Has("ncV2XwymRUKbPek_MIM-Gw"))
+}
+
+func TestWebhookRejected(t *testing.T) {
+	receiver, api := newTestReceiver(t)
+	now := time.Now()
+
+	require.Equal(t, http.StatusUnauthorized, postWebhook(receiver, signedWebhook(t, "failed.json", "wrong-key", now, "token-1")))
+	require.Equal(t, http.StatusNotAcceptable, postWebhook(receiver, signedWebhook(t, "failed.json", testSigningKey, now.Add(-time.Hour), "token-2")))
+	require.Equal(t, http.StatusNotAcceptable, postWebhook(receiver, signedWebhook(t, "failed.json", testSigningKey, now.Add(time.Hour), "token-3")))
+	require.Equal(t, http.StatusBadRequest, postWebhook(receiver, []byte("not json")))
+
+	request := httptest.NewRequest(http.MethodGet, "/webhook", nil)
+	recorder := httptest.NewRecorder()
+	receiver.ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusMethodNotAllowed, recorder.Code)
+
+	keys, err := api.edb.Keys()
+	require.Nil(t, err)
+	require.Empty(t, keys)
+
+	// tokens are forgotten once their timestamp is too old to be accepted
+	require.Equal(t, http.StatusOK, postWebhook(receiver, signedWebhook(t, "failed.json", testSigningKey, now, "token-4")))
+	receiver.now = func() time.Time { return now.Add(time.Hour) }
+	_, err = receiver.verify(mtypes.Signature{TimeStamp: strconv.FormatInt(now.Add(time.Hour).Unix(), 10), Token: "token-5", Signature: ""})
+	require.NotNil(t, err)
+	require.Len(t, receiver.tokens, 1)
+}
+
+func TestWebhookConfig(t *testing.T) {
+	api, _ := newTestClient(t)
+	viper.Set("webhook_signing_key", "")
+	_, err := NewWebhookReceiver(api)
+	require.NotNil(t, err)
+}
+
+func TestWebhookConcurrentReplay(t *testing.T) {
+	receiver, api := newTestReceiver(t)
+	payload := signedWebhook(t, "failed.json", testSigningKey, time.Now(), "token-1")
+
+	// hold storing so that every request is verified before any is stored
+	receiver.lock.Lock()
+	codes := make(chan int, 5)
+	for i := 0; i < cap(codes); i++ {
+		go func() { codes <- postWebhook(receiver, payload) }()
+	}
+	time.Sleep(50 * time.Millisecond)
+	receiver.lock.Unlock()
+	accepted := 0
+	for i := 0; i < cap(codes); i++ {
+		code := <-codes
+		if code == http.StatusOK {
+			accepted++
+		} else {
+			require.Equal(t, http.StatusNotAcceptable, code)
+		}
+	}
+	require.Equal(t, 1, accepted)
+	require.True(t, api.edb.Has(loadTestEvent(t, "failed.json").GetID()))
+
+	// a released token may be used again
+	var request struct {
+		Signature mtypes.Signature `json:"signature"`
+	}
+	require.Nil(t, json.Unmarshal(signedWebhook(t, "failed.json", testSigningKey, time.Now(), "token-2"), &request))
+	status, err := receiver.verify(request.Signature)
+	require.Nil(t, err, status)
+	_, err = receiver.verify(request.Signature)
+	require.NotNil(t, err)
+	receiver.release(request.Signature)
+	_, err = receiver.verify(request.Signature)
+	require.Nil(t, err)
+}
@@ -0,0 +1,83 @@
+/*
+Copyright © 2025 Matt Krueger <mkrueger@rstms.net>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+ 1. Redistributions of source code must retain the above copyright notice,
+    this list of conditions and the following disclaimer.
+
+ 2. Redistributions in binary form must reproduce the above copyright notice,
+    this list of conditions and the following disclaimer in the documentation
+    and/or other materials provided with the distribution.
+
+ 3. Neither the name of the copyright holder nor the names of its contributors
+    may be used to endorse or promote products derived from this software
+    without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+POSSIBILITY OF SUCH DAMAGE.
+*/
+package cmd
+
+import (
+	"context"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var webhookCmd = &cobra.Command{
+	Use:   "webhook",
+	Short: "receive mailgun webhooks",
+	Long: `
+Receive mailgun events pushed to a webhook instead of polling the events
+API.
+`,
+}
+
+var webhookServeCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "run the webhook listener",
+	Long: `
+Listen on webhook_listen (default :8080) for mailgun webhook POSTs to
+webhook_path (default /webhook), using HTTPS when webhook_tls_cert and
+webhook_tls_key are set.
+
+Each request must carry a valid signature made with the
+webhook_signing_key from the mailgun control panel.  Requests whose
+timestamp is more than webhook_max_age (default 5m) from the current time,
+or which repeat the token of an accepted request, are rejected.
+
+Received events are stored like polled events, and the bounce pipeline
+runs after events arrive and every poll_interval seconds, as with monitor.
+`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		DaemonizeDisabled = viper.GetBool("foreground")
+		Daemonize(func() {
+			api := NewClient()
+			receiver, err := NewWebhookReceiver(api)
+			cobra.CheckErr(err)
+			err = receiver.ListenAndServe(context.Background())
+			cobra.CheckErr(err)
+		}, "/var/log/mailgun")
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(webhookCmd)
+	webhookCmd.AddCommand(webhookServeCmd)
+	webhookServeCmd.Flags().StringP("listen", "L", "", "listen address")
+	viper.BindPFlag("webhook_listen", webhookServeCmd.Flags().Lookup("listen"))
+}